@@ -0,0 +1,262 @@
+// Package config carrega e persiste as preferências do usuário em
+// ~/.videcutterapp/config.yaml, com recarregamento automático via fsnotify
+// sempre que o arquivo é editado (manualmente ou pela própria aplicação
+// através de PUT /config).
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+// Config reúne todas as preferências persistidas do usuário.
+type Config struct {
+	ListenAddr         string              `yaml:"listenAddr"`
+	Concurrency        int                 `yaml:"concurrency"`
+	DefaultOutputDir   string              `yaml:"defaultOutputDir"`
+	DefaultProfile     string              `yaml:"defaultProfile"`
+	YtDlpPath          string              `yaml:"ytDlpPath"`
+	FFmpegPath         string              `yaml:"ffmpegPath"`
+	FFprobePath        string              `yaml:"ffprobePath"`
+	CookiesFile        string              `yaml:"cookiesFile"`
+	ProxyURL           string              `yaml:"proxyUrl"`
+	NormalizeByDefault bool                `yaml:"normalizeByDefault"`
+	TargetLUFS         float64             `yaml:"targetLufs"`
+	Presets            map[string][]string `yaml:"presets"`
+}
+
+// Default devolve a configuração usada quando ainda não existe um
+// config.yaml no disco.
+func Default() Config {
+	return Config{
+		ListenAddr:     "127.0.0.1:8080",
+		Concurrency:    1,
+		DefaultProfile: "whatsapp",
+		TargetLUFS:     defaultTargetLUFS,
+		Presets:        map[string][]string{},
+	}
+}
+
+// defaultTargetLUFS replica o padrão usado pelo pipeline de normalização
+// (ver loudnorm.go) para que um config.yaml novo já nasça consistente.
+const defaultTargetLUFS = -16.0
+
+// ToolPath devolve o caminho configurado pelo usuário para o executável
+// nomeado, ou "" se não houver override (nesse caso findTool segue para o
+// fallback de sempre: exeDir, CWD e PATH).
+func (c Config) ToolPath(name string) string {
+	switch name {
+	case "yt-dlp.exe":
+		return c.YtDlpPath
+	case "ffmpeg.exe":
+		return c.FFmpegPath
+	case "ffprobe.exe":
+		return c.FFprobePath
+	default:
+		return ""
+	}
+}
+
+// Manager guarda a configuração corrente em memória, sincroniza leituras
+// concorrentes e observa o arquivo em disco para recarregar a quente.
+type Manager struct {
+	mu      sync.RWMutex
+	cur     Config
+	path    string
+	watcher *fsnotify.Watcher
+}
+
+func defaultPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("não foi possível localizar o diretório do usuário: %v", err)
+	}
+	return filepath.Join(home, ".videcutterapp", "config.yaml"), nil
+}
+
+// Load lê o config.yaml em path (ou no caminho padrão, se path for vazio),
+// criando-o com os valores padrão caso ainda não exista.
+func Load(path string) (*Manager, error) {
+	if path == "" {
+		p, err := defaultPath()
+		if err != nil {
+			return nil, err
+		}
+		path = p
+	}
+
+	cfg := Default()
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("config inválida em %s: %v", path, err)
+		}
+	case os.IsNotExist(err):
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		if err := writeFile(path, cfg); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	return &Manager{cur: cfg, path: path}, nil
+}
+
+func writeFile(path string, cfg Config) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Get devolve uma cópia da configuração corrente.
+func (m *Manager) Get() Config {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cur
+}
+
+// Path devolve o arquivo de onde a configuração foi (ou será) carregada.
+func (m *Manager) Path() string {
+	return m.path
+}
+
+// Save grava cfg em disco e atualiza a configuração em memória. O Watch
+// também vê essa gravação, mas como a configuração em memória já é cfg, o
+// recarregamento em geral não encontra diferença e não chama onChange:
+// aplicar a mudança fica a cargo de quem chama Save.
+func (m *Manager) Save(cfg Config) error {
+	if err := writeFile(m.path, cfg); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.cur = cfg
+	m.mu.Unlock()
+	return nil
+}
+
+// Watch observa o diretório do config.yaml e chama onChange(old, new) toda
+// vez que o conteúdo do arquivo muda de fato.
+func (m *Manager) Watch(onChange func(old, new Config)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(m.path)); err != nil {
+		watcher.Close()
+		return err
+	}
+	m.watcher = watcher
+
+	go func() {
+		for {
+			select {
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(ev.Name) != filepath.Clean(m.path) {
+					continue
+				}
+				if ev.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+				m.reload(onChange)
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (m *Manager) reload(onChange func(old, new Config)) {
+	data, err := os.ReadFile(m.path)
+	if err != nil {
+		return
+	}
+	next := Default()
+	if err := yaml.Unmarshal(data, &next); err != nil {
+		return
+	}
+
+	m.mu.Lock()
+	old := m.cur
+	if reflect.DeepEqual(old, next) {
+		m.mu.Unlock()
+		return
+	}
+	m.cur = next
+	m.mu.Unlock()
+
+	if onChange != nil {
+		onChange(old, next)
+	}
+}
+
+// Close para de observar o arquivo de configuração.
+func (m *Manager) Close() {
+	if m.watcher != nil {
+		_ = m.watcher.Close()
+	}
+}
+
+// Diff descreve, em linhas legíveis, o que mudou entre duas configurações;
+// usado para logar recarregamentos de forma auditável.
+func Diff(old, new Config) []string {
+	var diffs []string
+	add := func(field string, oldVal, newVal any) {
+		diffs = append(diffs, fmt.Sprintf("%s: %v -> %v", field, oldVal, newVal))
+	}
+
+	if old.ListenAddr != new.ListenAddr {
+		add("listenAddr", old.ListenAddr, new.ListenAddr)
+	}
+	if old.Concurrency != new.Concurrency {
+		add("concurrency", old.Concurrency, new.Concurrency)
+	}
+	if old.DefaultOutputDir != new.DefaultOutputDir {
+		add("defaultOutputDir", old.DefaultOutputDir, new.DefaultOutputDir)
+	}
+	if old.DefaultProfile != new.DefaultProfile {
+		add("defaultProfile", old.DefaultProfile, new.DefaultProfile)
+	}
+	if old.YtDlpPath != new.YtDlpPath {
+		add("ytDlpPath", old.YtDlpPath, new.YtDlpPath)
+	}
+	if old.FFmpegPath != new.FFmpegPath {
+		add("ffmpegPath", old.FFmpegPath, new.FFmpegPath)
+	}
+	if old.FFprobePath != new.FFprobePath {
+		add("ffprobePath", old.FFprobePath, new.FFprobePath)
+	}
+	if old.CookiesFile != new.CookiesFile {
+		add("cookiesFile", old.CookiesFile, new.CookiesFile)
+	}
+	if old.ProxyURL != new.ProxyURL {
+		add("proxyUrl", old.ProxyURL, new.ProxyURL)
+	}
+	if old.NormalizeByDefault != new.NormalizeByDefault {
+		add("normalizeByDefault", old.NormalizeByDefault, new.NormalizeByDefault)
+	}
+	if old.TargetLUFS != new.TargetLUFS {
+		add("targetLufs", old.TargetLUFS, new.TargetLUFS)
+	}
+	if !reflect.DeepEqual(old.Presets, new.Presets) {
+		diffs = append(diffs, "presets: alterados")
+	}
+	return diffs
+}
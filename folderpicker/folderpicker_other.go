@@ -0,0 +1,121 @@
+//go:build !windows
+
+// Package folderpicker abre o seletor de pasta nativo do sistema
+// operacional, evitando a antiga dependência de PowerShell (Windows-only)
+// para essa funcionalidade.
+package folderpicker
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+var (
+	detectOnce    sync.Once
+	cachedBackend string
+	cachedErr     error
+)
+
+// detect escolhe, uma única vez por processo, qual ferramenta de seleção de
+// pasta está disponível neste sistema, na ordem de preferência da
+// plataforma.
+func detect() {
+	switch runtime.GOOS {
+	case "darwin":
+		if _, err := exec.LookPath("osascript"); err == nil {
+			cachedBackend = "osascript"
+			return
+		}
+		cachedErr = errors.New("osascript não encontrado")
+	case "linux":
+		for _, name := range []string{"zenity", "kdialog", "wish"} {
+			if _, err := exec.LookPath(name); err == nil {
+				cachedBackend = name
+				return
+			}
+		}
+		cachedErr = errors.New("nenhum seletor de pasta disponível (instale zenity, kdialog ou tk/wish)")
+	default:
+		cachedErr = fmt.Errorf("seleção de pasta não suportada em %s", runtime.GOOS)
+	}
+}
+
+// Capabilities informa se há um seletor de pasta disponível nesta máquina e,
+// se houver, qual backend foi escolhido.
+func Capabilities() (supported bool, backend string) {
+	detectOnce.Do(detect)
+	return cachedBackend != "", cachedBackend
+}
+
+// Pick abre o seletor de pasta nativo e bloqueia até o usuário escolher uma
+// pasta ou cancelar.
+func Pick() (path string, canceled bool, err error) {
+	detectOnce.Do(detect)
+	switch cachedBackend {
+	case "osascript":
+		return pickOSAScript()
+	case "zenity":
+		return pickZenity()
+	case "kdialog":
+		return pickKDialog()
+	case "wish":
+		return pickWish()
+	default:
+		return "", false, cachedErr
+	}
+}
+
+func pickOSAScript() (string, bool, error) {
+	cmd := exec.Command("osascript", "-e", `POSIX path of (choose folder)`)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(out), "User canceled") {
+			return "", true, nil
+		}
+		return "", false, fmt.Errorf("osascript falhou: %v\n%s", err, out)
+	}
+	return strings.TrimSpace(string(out)), false, nil
+}
+
+func pickZenity() (string, bool, error) {
+	out, err := exec.Command("zenity", "--file-selection", "--directory").Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return "", true, nil // usuário fechou o diálogo sem escolher
+		}
+		return "", false, fmt.Errorf("zenity falhou: %v", err)
+	}
+	return strings.TrimSpace(string(out)), false, nil
+}
+
+func pickKDialog() (string, bool, error) {
+	out, err := exec.Command("kdialog", "--getexistingdirectory").Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+			return "", true, nil // usuário cancelou o diálogo (mesma convenção do zenity)
+		}
+		return "", false, fmt.Errorf("kdialog falhou: %v", err)
+	}
+	return strings.TrimSpace(string(out)), false, nil
+}
+
+// pickWish é o fallback mínimo via Tcl/Tk quando nem zenity nem kdialog
+// estão instalados: pede ao Tk para abrir o diálogo padrão e imprimir o
+// caminho escolhido na saída padrão.
+func pickWish() (string, bool, error) {
+	cmd := exec.Command("wish")
+	cmd.Stdin = strings.NewReader(`puts [tk_chooseDirectory]; exit`)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", false, fmt.Errorf("wish (Tcl/Tk) falhou: %v", err)
+	}
+	path := strings.TrimSpace(string(out))
+	if path == "" {
+		return "", true, nil
+	}
+	return path, false, nil
+}
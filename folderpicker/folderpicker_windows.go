@@ -0,0 +1,79 @@
+//go:build windows
+
+// Package folderpicker abre o seletor de pasta nativo do sistema
+// operacional, evitando a antiga dependência de PowerShell (Windows-only)
+// para essa funcionalidade.
+package folderpicker
+
+import (
+	"errors"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	bifReturnOnlyFSDirs = 0x00000001
+	bifNewDialogStyle   = 0x00000040
+	maxPath             = 260
+)
+
+// browseInfo espelha a struct BROWSEINFOW do Win32, usada por
+// SHBrowseForFolderW.
+type browseInfo struct {
+	hwndOwner      uintptr
+	pidlRoot       uintptr
+	pszDisplayName *uint16
+	lpszTitle      *uint16
+	ulFlags        uint32
+	lpfn           uintptr
+	lParam         uintptr
+	iImage         int32
+}
+
+var (
+	shell32           = windows.NewLazySystemDLL("shell32.dll")
+	procBrowseForFold = shell32.NewProc("SHBrowseForFolderW")
+	procGetPathFromID = shell32.NewProc("SHGetPathFromIDListW")
+
+	ole32             = windows.NewLazySystemDLL("ole32.dll")
+	procCoTaskMemFree = ole32.NewProc("CoTaskMemFree")
+)
+
+// Capabilities sempre reporta o seletor nativo do Windows como disponível:
+// ele é compilado na própria aplicação e não depende de ferramentas externas.
+func Capabilities() (supported bool, backend string) {
+	return true, "win32"
+}
+
+// Pick abre o diálogo nativo SHBrowseForFolder e bloqueia até o usuário
+// escolher uma pasta ou cancelar.
+func Pick() (path string, canceled bool, err error) {
+	title, err := windows.UTF16PtrFromString("Selecione a pasta de destino")
+	if err != nil {
+		return "", false, err
+	}
+	displayName := make([]uint16, maxPath)
+
+	bi := browseInfo{
+		lpszTitle:      title,
+		ulFlags:        bifReturnOnlyFSDirs | bifNewDialogStyle,
+		pszDisplayName: &displayName[0],
+	}
+
+	pidl, _, _ := procBrowseForFold.Call(uintptr(unsafe.Pointer(&bi)))
+	if pidl == 0 {
+		return "", true, nil // usuário cancelou o diálogo
+	}
+	// o PIDL retornado por SHBrowseForFolderW é alocado pelo shell e precisa
+	// ser liberado pelo chamador; caso contrário vaza a cada pasta escolhida.
+	defer procCoTaskMemFree.Call(pidl)
+
+	pathBuf := make([]uint16, maxPath)
+	ok, _, _ := procGetPathFromID.Call(pidl, uintptr(unsafe.Pointer(&pathBuf[0])))
+	if ok == 0 {
+		return "", false, errors.New("falha ao resolver o caminho da pasta selecionada")
+	}
+	return strings.TrimRight(windows.UTF16ToString(pathBuf), "\x00"), false, nil
+}
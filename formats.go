@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ------------------- ENUMERAÇÃO DE FORMATOS (yt-dlp -J) -------------------
+
+// subconjunto do JSON de "yt-dlp -J" relevante para listar formatos.
+type ytdlpFormat struct {
+	FormatID   string  `json:"format_id"`
+	Ext        string  `json:"ext"`
+	Height     int     `json:"height"`
+	Width      int     `json:"width"`
+	FPS        float64 `json:"fps"`
+	VCodec     string  `json:"vcodec"`
+	ACodec     string  `json:"acodec"`
+	TBR        float64 `json:"tbr"`
+	FileSize   int64   `json:"filesize"`
+	FormatNote string  `json:"format_note"`
+}
+
+type ytdlpInfo struct {
+	Formats []ytdlpFormat `json:"formats"`
+}
+
+// FormatInfo é a representação normalizada de um stream disponível,
+// já pronta para o seletor de formatos do frontend.
+type FormatInfo struct {
+	ID         string  `json:"id"`
+	Container  string  `json:"container"`
+	Resolution string  `json:"resolution"`
+	FPS        float64 `json:"fps,omitempty"`
+	VCodec     string  `json:"vcodec,omitempty"`
+	ACodec     string  `json:"acodec,omitempty"`
+	Bitrate    float64 `json:"bitrate,omitempty"`
+	FileSize   int64   `json:"filesize,omitempty"`
+	VideoOnly  bool    `json:"videoOnly"`
+	AudioOnly  bool    `json:"audioOnly"`
+	Label      string  `json:"label"`
+}
+
+func isNone(codec string) bool {
+	return codec == "" || codec == "none"
+}
+
+func normalizeFormat(f ytdlpFormat) FormatInfo {
+	videoOnly := isNone(f.ACodec) && !isNone(f.VCodec)
+	audioOnly := isNone(f.VCodec) && !isNone(f.ACodec)
+
+	resolution := ""
+	if f.Width > 0 && f.Height > 0 {
+		resolution = fmt.Sprintf("%dx%d", f.Width, f.Height)
+	} else if f.Height > 0 {
+		resolution = fmt.Sprintf("%dp", f.Height)
+	}
+
+	label := f.FormatID
+	switch {
+	case audioOnly:
+		label = fmt.Sprintf("%s • áudio • %s", f.FormatID, strings.ToUpper(f.Ext))
+	case videoOnly:
+		label = fmt.Sprintf("%s • %s • %s (sem áudio)", f.FormatID, resolution, strings.ToUpper(f.Ext))
+	case resolution != "":
+		label = fmt.Sprintf("%s • %s • %s", f.FormatID, resolution, strings.ToUpper(f.Ext))
+	}
+	if f.FormatNote != "" {
+		label = label + " • " + f.FormatNote
+	}
+
+	return FormatInfo{
+		ID:         f.FormatID,
+		Container:  f.Ext,
+		Resolution: resolution,
+		FPS:        f.FPS,
+		VCodec:     f.VCodec,
+		ACodec:     f.ACodec,
+		Bitrate:    f.TBR,
+		FileSize:   f.FileSize,
+		VideoOnly:  videoOnly,
+		AudioOnly:  audioOnly,
+		Label:      label,
+	}
+}
+
+func listFormats(ctx context.Context, rawURL string) ([]FormatInfo, error) {
+	// URLs de HLS (.m3u8) são baixadas nativamente (ver hls.go), sem passar
+	// pelo yt-dlp, então seus formatos/IDs vêm direto das variantes da
+	// master playlist em vez de "yt-dlp -J".
+	if isHLSURL(rawURL) {
+		return listHLSFormats(ctx, rawURL)
+	}
+
+	yt, err := findTool("yt-dlp.exe")
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{"-J", "--no-playlist"}, ytdlpNetworkArgs()...)
+	args = append(args, rawURL)
+	cmd := exec.CommandContext(ctx, yt, args...)
+	raw, runErr := cmd.Output()
+	if runErr != nil {
+		return nil, fmt.Errorf("falha ao listar formatos (yt-dlp): %v", runErr)
+	}
+
+	var info ytdlpInfo
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return nil, fmt.Errorf("falha ao interpretar resposta do yt-dlp: %v", err)
+	}
+
+	formats := make([]FormatInfo, 0, len(info.Formats))
+	for _, f := range info.Formats {
+		formats = append(formats, normalizeFormat(f))
+	}
+	return formats, nil
+}
+
+// listHLSFormats expõe as variantes de uma master playlist HLS com o mesmo
+// formato de resposta de listFormats, mas com o ID próprio do pipeline HLS
+// (ver hlsVariant.ID) em vez do format_id do yt-dlp — é esse ID que o
+// frontend deve reenviar em FormatID para que selectVariant escolha a
+// variante certa.
+func listHLSFormats(ctx context.Context, rawURL string) ([]FormatInfo, error) {
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("URL do HLS inválida: %v", err)
+	}
+	body, err := fetchText(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	variants, _, err := parseMasterPlaylist(base, body)
+	if err != nil {
+		return nil, err
+	}
+
+	formats := make([]FormatInfo, 0, len(variants))
+	for _, v := range variants {
+		resolution := v.Resolution
+		if resolution == "" && v.Height > 0 {
+			resolution = fmt.Sprintf("%dp", v.Height)
+		}
+		label := v.ID
+		if resolution != "" {
+			label = fmt.Sprintf("%s • %s", v.ID, resolution)
+		}
+		if v.Codecs != "" {
+			label = label + " • " + v.Codecs
+		}
+		formats = append(formats, FormatInfo{
+			ID:         v.ID,
+			Container:  "hls",
+			Resolution: resolution,
+			Bitrate:    float64(v.Bandwidth) / 1000, // kbps, consistente com TBR do yt-dlp
+			Label:      label,
+		})
+	}
+	return formats, nil
+}
+
+func formatsHandler(w http.ResponseWriter, r *http.Request) {
+	url := strings.TrimSpace(r.URL.Query().Get("url"))
+	if url == "" {
+		http.Error(w, "parâmetro url é obrigatório", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	formats, err := listFormats(ctx, url)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(formats)
+}
+
+// buildFormatSelector decide o seletor "-f" a passar ao yt-dlp: se o usuário
+// escolheu formatos explícitos via /formats, eles têm prioridade sobre o
+// perfil pré-definido.
+func buildFormatSelector(profile, formatID, audioFormatID string) string {
+	formatID = strings.TrimSpace(formatID)
+	audioFormatID = strings.TrimSpace(audioFormatID)
+
+	if formatID != "" && audioFormatID != "" {
+		return formatID + "+" + audioFormatID
+	}
+	if formatID != "" {
+		return formatID
+	}
+	return "bv*[ext=mp4]+ba[ext=m4a]/b[ext=mp4]/bv*+ba/b"
+}
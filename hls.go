@@ -0,0 +1,774 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ------------------- HLS (m3u8) SEM yt-dlp -------------------
+
+// isHLSURL detecta links diretos para playlists HLS, que o yt-dlp às vezes
+// trava ou demora demais para processar.
+func isHLSURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return strings.Contains(strings.ToLower(rawURL), ".m3u8")
+	}
+	return strings.HasSuffix(strings.ToLower(u.Path), ".m3u8")
+}
+
+type hlsVariant struct {
+	ID         string // estável entre /formats e o seletor HLS; não é um índice
+	URI        string
+	Bandwidth  int
+	Height     int
+	Resolution string
+	Codecs     string
+	AudioGroup string // atributo AUDIO do EXT-X-STREAM-INF; referencia o GROUP-ID de uma hlsRendition
+}
+
+type hlsRendition struct {
+	GroupID string
+	Name    string
+	URI     string
+	Default bool
+}
+
+type hlsSegment struct {
+	Sequence    int
+	URI         string
+	Duration    float64
+	HasRange    bool
+	RangeLength int64
+	RangeOffset int64
+	KeyURI      string
+	KeyIV       []byte
+}
+
+// fetchText baixa um playlist via HTTPS (chaves AES usam fetchBytes).
+func fetchText(ctx context.Context, rawURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status inesperado (%d) ao buscar %s", resp.StatusCode, rawURL)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func fetchBytes(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status inesperado (%d) ao buscar %s", resp.StatusCode, rawURL)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// resolveURI resolve um URI de segmento/variante (absoluto ou relativo)
+// contra a URL base do playlist que o referenciou.
+func resolveURI(base *url.URL, ref string) (string, error) {
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(refURL).String(), nil
+}
+
+// parseAttributes interpreta uma lista de atributos estilo HLS
+// (CHAVE=valor,CHAVE="valor com, vírgula"), respeitando aspas.
+func parseAttributes(s string) map[string]string {
+	attrs := make(map[string]string)
+	var key strings.Builder
+	var val strings.Builder
+	inQuotes := false
+	readingKey := true
+
+	flush := func() {
+		k := strings.TrimSpace(key.String())
+		if k != "" {
+			attrs[k] = strings.Trim(strings.TrimSpace(val.String()), `"`)
+		}
+		key.Reset()
+		val.Reset()
+		readingKey = true
+	}
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			val.WriteRune(r)
+		case r == '=' && readingKey && !inQuotes:
+			readingKey = false
+		case r == ',' && !inQuotes:
+			flush()
+		default:
+			if readingKey {
+				key.WriteRune(r)
+			} else {
+				val.WriteRune(r)
+			}
+		}
+	}
+	flush()
+	return attrs
+}
+
+// parseMasterPlaylist extrai as variantes de qualidade e as trilhas de
+// áudio alternativas de uma master playlist HLS.
+func parseMasterPlaylist(base *url.URL, body string) ([]hlsVariant, []hlsRendition, error) {
+	var variants []hlsVariant
+	var renditions []hlsRendition
+
+	lines := strings.Split(body, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			attrs := parseAttributes(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+			if i+1 >= len(lines) {
+				continue
+			}
+			uriLine := strings.TrimSpace(lines[i+1])
+			i++
+			if uriLine == "" || strings.HasPrefix(uriLine, "#") {
+				continue
+			}
+			uri, err := resolveURI(base, uriLine)
+			if err != nil {
+				continue
+			}
+			bandwidth, _ := strconv.Atoi(attrs["BANDWIDTH"])
+			height := 0
+			resolution := attrs["RESOLUTION"]
+			if parts := strings.SplitN(resolution, "x", 2); len(parts) == 2 {
+				height, _ = strconv.Atoi(parts[1])
+			}
+			// ID é um identificador próprio do pipeline HLS (namespace
+			// "hls-"), distinto dos format_id do yt-dlp devolvidos por
+			// /formats para URLs não-HLS — os dois nunca devem ser
+			// confundidos por selectVariant.
+			variants = append(variants, hlsVariant{
+				ID:  fmt.Sprintf("hls-%d", len(variants)),
+				URI: uri, Bandwidth: bandwidth, Height: height,
+				Resolution: resolution, Codecs: attrs["CODECS"], AudioGroup: attrs["AUDIO"],
+			})
+
+		case strings.HasPrefix(line, "#EXT-X-MEDIA:"):
+			attrs := parseAttributes(strings.TrimPrefix(line, "#EXT-X-MEDIA:"))
+			if !strings.EqualFold(attrs["TYPE"], "AUDIO") || attrs["URI"] == "" {
+				continue
+			}
+			uri, err := resolveURI(base, attrs["URI"])
+			if err != nil {
+				continue
+			}
+			renditions = append(renditions, hlsRendition{
+				GroupID: attrs["GROUP-ID"], Name: attrs["NAME"], URI: uri,
+				Default: strings.EqualFold(attrs["DEFAULT"], "YES"),
+			})
+		}
+	}
+
+	if len(variants) == 0 {
+		return nil, nil, fmt.Errorf("nenhuma variante encontrada na master playlist")
+	}
+	return variants, renditions, nil
+}
+
+// parseMediaPlaylist extrai a lista ordenada de segmentos de uma playlist
+// de mídia (variante ou trilha de áudio).
+func parseMediaPlaylist(base *url.URL, body string) ([]hlsSegment, error) {
+	var segments []hlsSegment
+
+	sequence := 0
+	var duration float64
+	var rangeLen, rangeOff int64
+	hasRange := false
+	var keyURI string
+	var keyIV []byte
+
+	lines := strings.Split(body, "\n")
+	for _, raw := range lines {
+		line := strings.TrimSpace(raw)
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			sequence, _ = strconv.Atoi(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"))
+
+		case strings.HasPrefix(line, "#EXTINF:"):
+			field := strings.TrimPrefix(line, "#EXTINF:")
+			field = strings.SplitN(field, ",", 2)[0]
+			duration, _ = strconv.ParseFloat(strings.TrimSpace(field), 64)
+
+		case strings.HasPrefix(line, "#EXT-X-BYTERANGE:"):
+			field := strings.TrimPrefix(line, "#EXT-X-BYTERANGE:")
+			parts := strings.SplitN(field, "@", 2)
+			prevEnd := rangeOff + rangeLen // fim do range anterior, antes de sobrescrever rangeLen
+			rangeLen, _ = strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+			if len(parts) == 2 {
+				rangeOff, _ = strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+			} else {
+				rangeOff = prevEnd // contíguo ao range anterior, por padrão
+			}
+			hasRange = true
+
+		case strings.HasPrefix(line, "#EXT-X-KEY:"):
+			attrs := parseAttributes(strings.TrimPrefix(line, "#EXT-X-KEY:"))
+			if strings.EqualFold(attrs["METHOD"], "NONE") || attrs["METHOD"] == "" {
+				keyURI, keyIV = "", nil
+				continue
+			}
+			if attrs["URI"] != "" {
+				resolved, err := resolveURI(base, attrs["URI"])
+				if err == nil {
+					keyURI = resolved
+				}
+			}
+			if iv := attrs["IV"]; iv != "" {
+				keyIV = parseHexIV(iv)
+			} else {
+				keyIV = nil
+			}
+
+		case line == "" || strings.HasPrefix(line, "#"):
+			// outras tags (EXT-X-VERSION, EXT-X-ENDLIST, etc.) não afetam o parsing
+
+		default:
+			uri, err := resolveURI(base, line)
+			if err != nil {
+				continue
+			}
+			iv := keyIV
+			if keyURI != "" && iv == nil {
+				// IV default: número de sequência do segmento, alinhado à direita em 16 bytes
+				iv = make([]byte, 16)
+				binary.BigEndian.PutUint64(iv[8:], uint64(sequence))
+			}
+			segments = append(segments, hlsSegment{
+				Sequence: sequence, URI: uri, Duration: duration,
+				HasRange: hasRange, RangeLength: rangeLen, RangeOffset: rangeOff,
+				KeyURI: keyURI, KeyIV: iv,
+			})
+			sequence++
+			hasRange = false
+		}
+	}
+
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("nenhum segmento encontrado na playlist")
+	}
+	return segments, nil
+}
+
+func parseHexIV(s string) []byte {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil
+	}
+	if len(b) < 16 {
+		padded := make([]byte, 16)
+		copy(padded[16-len(b):], b)
+		return padded
+	}
+	return b
+}
+
+// selectVariant escolhe a variante mais adequada: pelo ID explícito
+// devolvido por /formats para esta mesma URL (ex. "hls-2") ou, na ausência
+// dele, pela altura alvo do perfil, caindo para a de maior bitrate quando
+// nada corresponde. formatID nunca é um índice: os IDs de variantes HLS não
+// têm relação com os format_id do yt-dlp, então não devem ser reinterpretados
+// como posição na lista.
+func selectVariant(variants []hlsVariant, profile, formatID string) hlsVariant {
+	if formatID = strings.TrimSpace(formatID); formatID != "" {
+		for _, v := range variants {
+			if v.ID == formatID {
+				return v
+			}
+		}
+	}
+
+	target := targetHeightForProfile(profile)
+	sorted := append([]hlsVariant(nil), variants...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Bandwidth > sorted[j].Bandwidth })
+
+	if target == 0 {
+		return sorted[0] // "original": maior qualidade disponível
+	}
+	best := sorted[0]
+	bestDiff := -1
+	for _, v := range sorted {
+		if v.Height == 0 {
+			continue
+		}
+		diff := v.Height - target
+		if diff < 0 {
+			diff = -diff
+		}
+		if bestDiff == -1 || diff < bestDiff {
+			best, bestDiff = v, diff
+		}
+	}
+	return best
+}
+
+// selectAudioRendition escolhe, dentro do grupo AUDIO referenciado pela
+// variante selecionada, a trilha marcada como DEFAULT=YES ou, na ausência
+// dela, a primeira do grupo. Devolve ok=false se a variante não referencia
+// nenhum grupo de áudio (áudio já embutido nos próprios segmentos) ou se o
+// grupo não existir entre as renditions da master playlist.
+func selectAudioRendition(renditions []hlsRendition, groupID string) (hlsRendition, bool) {
+	if groupID == "" {
+		return hlsRendition{}, false
+	}
+	var first hlsRendition
+	found := false
+	for _, r := range renditions {
+		if r.GroupID != groupID {
+			continue
+		}
+		if !found {
+			first = r
+			found = true
+		}
+		if r.Default {
+			return r, true
+		}
+	}
+	return first, found
+}
+
+func targetHeightForProfile(profile string) int {
+	switch strings.ToLower(profile) {
+	case "480p":
+		return 480
+	case "720p":
+		return 720
+	case "1080p":
+		return 1080
+	case "4k", "2160p", "uhd":
+		return 2160
+	default:
+		return 0 // "original"/"whatsapp"/"mp3": sem alvo de altura específico
+	}
+}
+
+// ------------------- DOWNLOAD DE SEGMENTOS -------------------
+
+var hlsKeyCache sync.Map // keyURI -> []byte
+
+func fetchKey(ctx context.Context, keyURI string) ([]byte, error) {
+	if v, ok := hlsKeyCache.Load(keyURI); ok {
+		return v.([]byte), nil
+	}
+	key, err := fetchBytes(ctx, keyURI)
+	if err != nil {
+		return nil, err
+	}
+	hlsKeyCache.Store(keyURI, key)
+	return key, nil
+}
+
+func decryptSegment(ctx context.Context, data []byte, seg hlsSegment) ([]byte, error) {
+	if seg.KeyURI == "" {
+		return data, nil
+	}
+	key, err := fetchKey(ctx, seg.KeyURI)
+	if err != nil {
+		return nil, fmt.Errorf("falha ao buscar chave AES-128: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("segmento com tamanho inválido para AES-CBC")
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, seg.KeyIV).CryptBlocks(out, data)
+	return pkcs7Unpad(out), nil
+}
+
+func pkcs7Unpad(data []byte) []byte {
+	if len(data) == 0 {
+		return data
+	}
+	padLen := int(data[len(data)-1])
+	if padLen <= 0 || padLen > len(data) {
+		return data
+	}
+	return data[:len(data)-padLen]
+}
+
+// downloadSegment baixa (e decifra, se necessário) um segmento, com
+// retentativa e backoff linear (500ms, 1s, 1,5s entre as tentativas).
+func downloadSegment(ctx context.Context, seg hlsSegment) ([]byte, error) {
+	const maxAttempts = 4
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(attempt) * 500 * time.Millisecond
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, seg.URI, nil)
+		if err != nil {
+			return nil, err
+		}
+		if seg.HasRange {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", seg.RangeOffset, seg.RangeOffset+seg.RangeLength-1))
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("status inesperado (%d)", resp.StatusCode)
+			continue
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return decryptSegment(ctx, data, seg)
+	}
+	return nil, fmt.Errorf("falha ao baixar segmento após %d tentativas: %v", maxAttempts, lastErr)
+}
+
+// downloadSegments baixa todos os segmentos com um pool de workers e grava
+// cada um em destDir, reportando fragment/totalFragments via onProgress.
+func downloadSegments(ctx context.Context, segments []hlsSegment, destDir string, onProgress func(done, total int)) ([]string, error) {
+	const workers = 6
+	paths := make([]string, len(segments))
+	errs := make([]error, len(segments))
+
+	jobsCh := make(chan int)
+	var wg sync.WaitGroup
+	var doneCount segmentCounter
+
+	worker := func() {
+		defer wg.Done()
+		for idx := range jobsCh {
+			data, err := downloadSegment(ctx, segments[idx])
+			if err != nil {
+				errs[idx] = err
+			} else {
+				path := filepath.Join(destDir, fmt.Sprintf("segment-%06d.ts", idx))
+				if werr := os.WriteFile(path, data, 0644); werr != nil {
+					errs[idx] = werr
+				} else {
+					paths[idx] = path
+				}
+			}
+			done := doneCount.inc()
+			if onProgress != nil {
+				onProgress(done, len(segments))
+			}
+		}
+	}
+
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go worker()
+	}
+	go func() {
+		for i := range segments {
+			select {
+			case jobsCh <- i:
+			case <-ctx.Done():
+			}
+		}
+		close(jobsCh)
+	}()
+	wg.Wait()
+
+	if ctxCanceled(ctx) {
+		return nil, context.Canceled
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// segmentCounter é um contador simples e seguro para concorrência, usado só
+// para o progresso de download de segmentos.
+type segmentCounter struct {
+	mu  sync.Mutex
+	val int
+}
+
+func (c *segmentCounter) inc() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.val++
+	return c.val
+}
+
+// writeConcatList grava a lista ordenada de segmentos no formato exigido
+// pelo demuxer concat do ffmpeg.
+func writeConcatList(destDir string, paths []string) (string, error) {
+	listPath := filepath.Join(destDir, "concat.txt")
+	f, err := os.Create(listPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, p := range paths {
+		fmt.Fprintf(w, "file '%s'\n", filepath.ToSlash(p))
+	}
+	if err := w.Flush(); err != nil {
+		return "", err
+	}
+	return listPath, nil
+}
+
+// ------------------- PIPELINE HLS -------------------
+
+// handleHLS baixa um stream HLS (.m3u8, ao vivo ou VOD) diretamente, sem
+// passar pelo yt-dlp, e entrega os segmentos ao ffmpeg via concat demuxer.
+func handleHLS(ctx context.Context, rawURL, profile, start, end, outDir, formatID string) (string, error) {
+	setStage(ctx, "Baixando", "Lendo playlist HLS...", true)
+
+	ff, err := findTool("ffmpeg.exe")
+	if err != nil {
+		setStage(ctx, "Erro", err.Error(), false)
+		return "", err
+	}
+	targetDir, err := resolveOutputDir(outDir)
+	if err != nil {
+		setStage(ctx, "Erro", err.Error(), false)
+		return "", err
+	}
+	if err := validateTimes(start, end); err != nil {
+		setStage(ctx, "Erro", err.Error(), false)
+		return "", err
+	}
+
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		setStage(ctx, "Erro", "URL do HLS inválida", false)
+		return "", err
+	}
+	masterBody, err := fetchText(ctx, rawURL)
+	if err != nil {
+		setStage(ctx, "Erro", err.Error(), false)
+		return "", err
+	}
+
+	variants, renditions, err := parseMasterPlaylist(base, masterBody)
+	if err != nil {
+		setStage(ctx, "Erro", err.Error(), false)
+		return "", err
+	}
+	variant := selectVariant(variants, profile, formatID)
+
+	// quando a variante referencia um grupo AUDIO, o áudio não está nos
+	// segmentos dela: vem de uma rendition separada (ver selectAudioRendition).
+	// Se o grupo referenciado não existir, é melhor falhar explicitamente do
+	// que entregar um vídeo mudo sem avisar.
+	var audioRendition hlsRendition
+	hasAudioRendition := false
+	if variant.AudioGroup != "" {
+		audioRendition, hasAudioRendition = selectAudioRendition(renditions, variant.AudioGroup)
+		if !hasAudioRendition {
+			err := fmt.Errorf("a variante selecionada referencia o grupo de áudio %q, mas nenhuma rendition correspondente foi encontrada na master playlist", variant.AudioGroup)
+			setStage(ctx, "Erro", err.Error(), false)
+			return "", err
+		}
+	}
+
+	variantBase, err := url.Parse(variant.URI)
+	if err != nil {
+		setStage(ctx, "Erro", "URL da variante inválida", false)
+		return "", err
+	}
+	variantBody, err := fetchText(ctx, variant.URI)
+	if err != nil {
+		setStage(ctx, "Erro", err.Error(), false)
+		return "", err
+	}
+	segments, err := parseMediaPlaylist(variantBase, variantBody)
+	if err != nil {
+		setStage(ctx, "Erro", err.Error(), false)
+		return "", err
+	}
+
+	var audioSegments []hlsSegment
+	if hasAudioRendition {
+		audioBase, err := url.Parse(audioRendition.URI)
+		if err != nil {
+			setStage(ctx, "Erro", "URL da trilha de áudio inválida", false)
+			return "", err
+		}
+		audioBody, err := fetchText(ctx, audioRendition.URI)
+		if err != nil {
+			setStage(ctx, "Erro", err.Error(), false)
+			return "", err
+		}
+		audioSegments, err = parseMediaPlaylist(audioBase, audioBody)
+		if err != nil {
+			setStage(ctx, "Erro", err.Error(), false)
+			return "", err
+		}
+	}
+
+	_, _, err = ensureDirs()
+	if err != nil {
+		setStage(ctx, "Erro", err.Error(), false)
+		return "", err
+	}
+	tempDir := filepath.Join(exeDir(), "temp", "hls-"+timestampName())
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		setStage(ctx, "Erro", err.Error(), false)
+		return "", err
+	}
+	audioDir := filepath.Join(tempDir, "audio")
+	if hasAudioRendition {
+		if err := os.MkdirAll(audioDir, 0755); err != nil {
+			setStage(ctx, "Erro", err.Error(), false)
+			return "", err
+		}
+	}
+
+	setStage(ctx, "Baixando", fmt.Sprintf("Baixando %d segmentos de vídeo...", len(segments)), true)
+	paths, err := downloadSegments(ctx, segments, tempDir, func(done, total int) {
+		progressEvents.publish(ProgressEvent{
+			JobID: jobIDFromContext(ctx), Stage: "Baixando", Running: true,
+			Percent:  float64(done) / float64(total) * 100,
+			Fragment: done, TotalFragments: total,
+		})
+	})
+	if err != nil {
+		_ = os.RemoveAll(tempDir)
+		if ctxCanceled(ctx) {
+			return "", context.Canceled
+		}
+		setStage(ctx, "Erro", err.Error(), false)
+		return "", err
+	}
+
+	listPath, err := writeConcatList(tempDir, paths)
+	if err != nil {
+		_ = os.RemoveAll(tempDir)
+		setStage(ctx, "Erro", err.Error(), false)
+		return "", err
+	}
+
+	var audioListPath string
+	if hasAudioRendition {
+		setStage(ctx, "Baixando", fmt.Sprintf("Baixando %d segmentos de áudio...", len(audioSegments)), true)
+		audioPaths, err := downloadSegments(ctx, audioSegments, audioDir, func(done, total int) {
+			progressEvents.publish(ProgressEvent{
+				JobID: jobIDFromContext(ctx), Stage: "Baixando", Running: true,
+				Percent:  float64(done) / float64(total) * 100,
+				Fragment: done, TotalFragments: total,
+			})
+		})
+		if err != nil {
+			_ = os.RemoveAll(tempDir)
+			if ctxCanceled(ctx) {
+				return "", context.Canceled
+			}
+			setStage(ctx, "Erro", err.Error(), false)
+			return "", err
+		}
+		audioListPath, err = writeConcatList(audioDir, audioPaths)
+		if err != nil {
+			_ = os.RemoveAll(tempDir)
+			setStage(ctx, "Erro", err.Error(), false)
+			return "", err
+		}
+	}
+
+	title := "hls-" + timestampName()
+	outFile := filepath.Join(targetDir, title+outputExt(profile))
+
+	setStage(ctx, "Convertendo", "Remuxando/recodificando com ffmpeg...", true)
+	var ffArgs []string
+	ffArgs = append(ffArgs, "-hide_banner", "-loglevel", "info", "-progress", "pipe:1", "-nostats")
+	ffArgs = append(ffArgs, "-f", "concat", "-safe", "0")
+	if start != "" && end != "" {
+		ffArgs = append(ffArgs, "-ss", start, "-to", end)
+	}
+	ffArgs = append(ffArgs, "-i", listPath)
+	if audioListPath != "" {
+		ffArgs = append(ffArgs, "-f", "concat", "-safe", "0")
+		if start != "" && end != "" {
+			ffArgs = append(ffArgs, "-ss", start, "-to", end)
+		}
+		ffArgs = append(ffArgs, "-i", audioListPath)
+		ffArgs = append(ffArgs, "-map", "0:v:0", "-map", "1:a:0")
+	}
+	ffArgs = append(ffArgs, ffmpegArgsPreset(profile)...)
+	if strings.ToLower(profile) != "mp3" {
+		ffArgs = append(ffArgs, "-avoid_negative_ts", "make_zero")
+	}
+	ffArgs = append(ffArgs, "-y", outFile)
+
+	ffCmd := exec.CommandContext(ctx, ff, ffArgs...)
+	ffParser := newFfmpegProgressParser(0)
+	if log, _, runErr := runCmdWithProgress(ffCmd, func(line string) {
+		publishFfmpegLine(ctx, ffParser, "Convertendo", line)
+	}); runErr != nil {
+		_ = os.RemoveAll(tempDir)
+		removeIfExists(outFile)
+		if ctxCanceled(ctx) {
+			return "", context.Canceled
+		}
+		setStage(ctx, "Erro", fmt.Sprintf("ffmpeg falhou:\n%s", log), false)
+		return "", fmt.Errorf("falha ao remuxar HLS (ffmpeg): %v\n%s", runErr, log)
+	}
+
+	_ = os.RemoveAll(tempDir)
+	openInExplorerSelect(outFile)
+	setStage(ctx, "Finalizado", "Download HLS concluído", false)
+	return outFile, nil
+}
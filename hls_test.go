@@ -0,0 +1,297 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseAttributes(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]string
+	}{
+		{
+			name: "simples",
+			in:   `BANDWIDTH=1280000,RESOLUTION=1920x1080`,
+			want: map[string]string{"BANDWIDTH": "1280000", "RESOLUTION": "1920x1080"},
+		},
+		{
+			name: "valor entre aspas com vírgula",
+			in:   `CODECS="avc1.640028,mp4a.40.2",BANDWIDTH=1280000`,
+			want: map[string]string{"CODECS": "avc1.640028,mp4a.40.2", "BANDWIDTH": "1280000"},
+		},
+		{
+			name: "espaços ao redor de chave e valor",
+			in:   ` TYPE=AUDIO , GROUP-ID="aac" , NAME="Português" `,
+			want: map[string]string{"TYPE": "AUDIO", "GROUP-ID": "aac", "NAME": "Português"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseAttributes(tt.in)
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseAttributes(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Errorf("parseAttributes(%q)[%q] = %q, want %q", tt.in, k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestParseMasterPlaylist(t *testing.T) {
+	body := `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,CODECS="avc1.4d401e,mp4a.40.2"
+360p/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2800000,RESOLUTION=1920x1080,CODECS="avc1.640028,mp4a.40.2"
+1080p/index.m3u8
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Português",DEFAULT=YES,URI="audio/pt/index.m3u8"
+`
+	base, err := url.Parse("https://example.com/hls/master.m3u8")
+	if err != nil {
+		t.Fatalf("url.Parse falhou: %v", err)
+	}
+
+	variants, renditions, err := parseMasterPlaylist(base, body)
+	if err != nil {
+		t.Fatalf("parseMasterPlaylist retornou erro: %v", err)
+	}
+
+	if len(variants) != 2 {
+		t.Fatalf("esperava 2 variantes, veio %d", len(variants))
+	}
+	if variants[0].ID == variants[1].ID {
+		t.Errorf("variantes devem ter IDs distintos, ambas vieram %q", variants[0].ID)
+	}
+	if variants[0].ID != "hls-0" || variants[1].ID != "hls-1" {
+		t.Errorf("IDs inesperados: %q, %q", variants[0].ID, variants[1].ID)
+	}
+	if variants[1].URI != "https://example.com/hls/1080p/index.m3u8" {
+		t.Errorf("URI da variante não resolvida contra a base: %q", variants[1].URI)
+	}
+	if variants[1].Height != 1080 {
+		t.Errorf("altura da variante = %d, want 1080", variants[1].Height)
+	}
+
+	if len(renditions) != 1 {
+		t.Fatalf("esperava 1 trilha de áudio, veio %d", len(renditions))
+	}
+	if renditions[0].URI != "https://example.com/hls/audio/pt/index.m3u8" {
+		t.Errorf("URI da trilha de áudio não resolvida: %q", renditions[0].URI)
+	}
+	if !renditions[0].Default {
+		t.Errorf("trilha de áudio deveria ser a default")
+	}
+}
+
+func TestParseMasterPlaylistSemVariantes(t *testing.T) {
+	base, _ := url.Parse("https://example.com/master.m3u8")
+	if _, _, err := parseMasterPlaylist(base, "#EXTM3U\n"); err == nil {
+		t.Errorf("esperava erro para playlist sem nenhuma variante")
+	}
+}
+
+func TestParseMediaPlaylist(t *testing.T) {
+	body := `#EXTM3U
+#EXT-X-MEDIA-SEQUENCE:5
+#EXTINF:9.009,
+seg-05.ts
+#EXTINF:9.009,
+seg-06.ts
+`
+	base, _ := url.Parse("https://example.com/hls/1080p/index.m3u8")
+
+	segments, err := parseMediaPlaylist(base, body)
+	if err != nil {
+		t.Fatalf("parseMediaPlaylist retornou erro: %v", err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("esperava 2 segmentos, veio %d", len(segments))
+	}
+	if segments[0].Sequence != 5 || segments[1].Sequence != 6 {
+		t.Errorf("sequências = %d, %d; want 5, 6", segments[0].Sequence, segments[1].Sequence)
+	}
+	if segments[0].URI != "https://example.com/hls/1080p/seg-05.ts" {
+		t.Errorf("URI do segmento não resolvida: %q", segments[0].URI)
+	}
+	if segments[0].Duration != 9.009 {
+		t.Errorf("duração = %v, want 9.009", segments[0].Duration)
+	}
+}
+
+// TestParseMediaPlaylistByteRangeOmittedOffset cobre o caso em que
+// #EXT-X-BYTERANGE omite o "@offset" opcional: o range deve ser contíguo ao
+// anterior (offset anterior + tamanho anterior), e não ao tamanho do range
+// atual.
+func TestParseMediaPlaylistByteRangeOmittedOffset(t *testing.T) {
+	body := `#EXTM3U
+#EXT-X-BYTERANGE:1000@500
+seg.ts
+#EXT-X-BYTERANGE:800
+seg.ts
+`
+	base, _ := url.Parse("https://example.com/hls/1080p/index.m3u8")
+
+	segments, err := parseMediaPlaylist(base, body)
+	if err != nil {
+		t.Fatalf("parseMediaPlaylist retornou erro: %v", err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("esperava 2 segmentos, veio %d", len(segments))
+	}
+	if segments[0].RangeOffset != 500 || segments[0].RangeLength != 1000 {
+		t.Fatalf("primeiro range = offset %d, length %d; want 500, 1000", segments[0].RangeOffset, segments[0].RangeLength)
+	}
+	if segments[1].RangeOffset != 1500 || segments[1].RangeLength != 800 {
+		t.Fatalf("segundo range = offset %d, length %d; want 1500, 800", segments[1].RangeOffset, segments[1].RangeLength)
+	}
+}
+
+// TestParseMediaPlaylistIVFallback cobre o caso em que uma chave AES-128 não
+// informa IV explícito: o IV deve cair para o número de sequência do
+// segmento, alinhado à direita em 16 bytes (conforme a seção 5.2 da RFC 8216).
+func TestParseMediaPlaylistIVFallback(t *testing.T) {
+	body := `#EXTM3U
+#EXT-X-MEDIA-SEQUENCE:7
+#EXT-X-KEY:METHOD=AES-128,URI="https://example.com/hls/key"
+#EXTINF:9.009,
+seg-07.ts
+`
+	base, _ := url.Parse("https://example.com/hls/1080p/index.m3u8")
+
+	segments, err := parseMediaPlaylist(base, body)
+	if err != nil {
+		t.Fatalf("parseMediaPlaylist retornou erro: %v", err)
+	}
+	if len(segments) != 1 {
+		t.Fatalf("esperava 1 segmento, veio %d", len(segments))
+	}
+	seg := segments[0]
+	if seg.KeyURI != "https://example.com/hls/key" {
+		t.Errorf("KeyURI = %q", seg.KeyURI)
+	}
+	if len(seg.KeyIV) != 16 {
+		t.Fatalf("IV deveria ter 16 bytes, tem %d", len(seg.KeyIV))
+	}
+	wantIV := make([]byte, 16)
+	wantIV[15] = 7 // sequência 7 cabe no último byte
+	for i := range wantIV {
+		if seg.KeyIV[i] != wantIV[i] {
+			t.Fatalf("IV = %x, want %x", seg.KeyIV, wantIV)
+		}
+	}
+}
+
+func TestParseMediaPlaylistComIVExplicito(t *testing.T) {
+	body := `#EXTM3U
+#EXT-X-KEY:METHOD=AES-128,URI="https://example.com/hls/key",IV=0x0000000000000000000000000000FF
+#EXTINF:9.009,
+seg-00.ts
+`
+	base, _ := url.Parse("https://example.com/hls/1080p/index.m3u8")
+
+	segments, err := parseMediaPlaylist(base, body)
+	if err != nil {
+		t.Fatalf("parseMediaPlaylist retornou erro: %v", err)
+	}
+	if segments[0].KeyIV[15] != 0xFF {
+		t.Errorf("IV explícito não foi respeitado: %x", segments[0].KeyIV)
+	}
+}
+
+func TestSelectVariant(t *testing.T) {
+	variants := []hlsVariant{
+		{ID: "hls-0", Bandwidth: 800000, Height: 360},
+		{ID: "hls-1", Bandwidth: 1500000, Height: 720},
+		{ID: "hls-2", Bandwidth: 2800000, Height: 1080},
+	}
+
+	t.Run("por ID explícito", func(t *testing.T) {
+		got := selectVariant(variants, "720p", "hls-2")
+		if got.ID != "hls-2" {
+			t.Errorf("selectVariant com formatID=hls-2 devolveu %q, want hls-2", got.ID)
+		}
+	})
+
+	t.Run("formatID desconhecido cai para a altura do perfil", func(t *testing.T) {
+		got := selectVariant(variants, "720p", "nao-existe")
+		if got.ID != "hls-1" {
+			t.Errorf("selectVariant devolveu %q, want hls-1 (720p)", got.ID)
+		}
+	})
+
+	t.Run("sem formatID usa a altura do perfil", func(t *testing.T) {
+		got := selectVariant(variants, "480p", "")
+		if got.ID != "hls-0" {
+			t.Errorf("selectVariant(480p) devolveu %q, want hls-0 (mais próxima de 480p)", got.ID)
+		}
+	})
+
+	t.Run("perfil original usa o maior bitrate", func(t *testing.T) {
+		got := selectVariant(variants, "original", "")
+		if got.ID != "hls-2" {
+			t.Errorf("selectVariant(original) devolveu %q, want hls-2 (maior bitrate)", got.ID)
+		}
+	})
+}
+
+func TestParseMasterPlaylistAudioGroup(t *testing.T) {
+	body := `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="Português",DEFAULT=YES,URI="audio/pt/index.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=2800000,RESOLUTION=1920x1080,CODECS="avc1.640028,mp4a.40.2",AUDIO="aac"
+1080p/index.m3u8
+`
+	base, _ := url.Parse("https://example.com/hls/master.m3u8")
+
+	variants, _, err := parseMasterPlaylist(base, body)
+	if err != nil {
+		t.Fatalf("parseMasterPlaylist retornou erro: %v", err)
+	}
+	if variants[0].AudioGroup != "aac" {
+		t.Errorf("AudioGroup = %q, want %q", variants[0].AudioGroup, "aac")
+	}
+}
+
+func TestSelectAudioRendition(t *testing.T) {
+	renditions := []hlsRendition{
+		{GroupID: "aac", Name: "English", URI: "https://example.com/audio/en.m3u8"},
+		{GroupID: "aac", Name: "Português", URI: "https://example.com/audio/pt.m3u8", Default: true},
+		{GroupID: "ac3", Name: "English 5.1", URI: "https://example.com/audio/en-ac3.m3u8"},
+	}
+
+	t.Run("prefere a rendition marcada como default", func(t *testing.T) {
+		got, ok := selectAudioRendition(renditions, "aac")
+		if !ok {
+			t.Fatalf("esperava encontrar o grupo aac")
+		}
+		if got.Name != "Português" {
+			t.Errorf("selectAudioRendition devolveu %q, want a default (Português)", got.Name)
+		}
+	})
+
+	t.Run("sem default cai para a primeira do grupo", func(t *testing.T) {
+		got, ok := selectAudioRendition(renditions, "ac3")
+		if !ok {
+			t.Fatalf("esperava encontrar o grupo ac3")
+		}
+		if got.Name != "English 5.1" {
+			t.Errorf("selectAudioRendition devolveu %q, want English 5.1", got.Name)
+		}
+	})
+
+	t.Run("grupo inexistente", func(t *testing.T) {
+		if _, ok := selectAudioRendition(renditions, "nao-existe"); ok {
+			t.Errorf("esperava ok=false para um grupo que não existe nas renditions")
+		}
+	})
+
+	t.Run("variante sem grupo de áudio", func(t *testing.T) {
+		if _, ok := selectAudioRendition(renditions, ""); ok {
+			t.Errorf("esperava ok=false quando a variante não referencia nenhum grupo de áudio")
+		}
+	})
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"videcutterapp/config"
+)
+
+// ------------------- FILA DE JOBS (persistente) -------------------
+
+// JobState é o estado do ciclo de vida de um job na fila.
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobDone      JobState = "done"
+	JobError     JobState = "error"
+	JobCanceled  JobState = "canceled"
+	jobLogMaxLen          = 200
+)
+
+// Job é a unidade persistida da fila: o pedido original, seu estado e o
+// resultado (caminho de saída ou erro), sobrevivendo a reinícios do processo.
+type Job struct {
+	ID         string    `json:"id"`
+	Request    actionReq `json:"request"`
+	State      JobState  `json:"state"`
+	CreatedAt  time.Time `json:"createdAt"`
+	StartedAt  time.Time `json:"startedAt,omitempty"`
+	FinishedAt time.Time `json:"finishedAt,omitempty"`
+	OutputPath string    `json:"outputPath,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	LogTail    []string  `json:"logTail,omitempty"`
+}
+
+var jobsBucket = []byte("jobs")
+
+// jobQueue é um pool de workers (ver SetConcurrency), apoiado em BoltDB
+// para que jobs em fila/execução sobrevivam a um restart do servidor.
+type jobQueue struct {
+	mu       sync.Mutex
+	db       *bbolt.DB
+	jobs     map[string]*Job
+	order    []string // ordem de chegada, para listagem estável
+	cancels  map[string]context.CancelFunc
+	waiters  map[string][]chan struct{}
+	pending  chan string
+	idSeq    uint64
+	nWorkers int
+}
+
+func newJobQueue(dbPath string, concurrency int) (*jobQueue, error) {
+	db, err := bbolt.Open(dbPath, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(jobsBucket)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	q := &jobQueue{
+		db:      db,
+		jobs:    make(map[string]*Job),
+		cancels: make(map[string]context.CancelFunc),
+		waiters: make(map[string][]chan struct{}),
+		pending: make(chan string, 1024),
+	}
+	if err := q.restore(); err != nil {
+		return nil, err
+	}
+	q.SetConcurrency(concurrency)
+	return q, nil
+}
+
+// SetConcurrency garante que ao menos n workers estejam rodando. Workers já
+// em execução nunca são derrubados (um job em andamento não é interrompido
+// por uma redução de concorrência) — reduzir o valor só impede que novos
+// workers sejam abertos até o número corrente ser alcançado de novo.
+func (q *jobQueue) SetConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	q.mu.Lock()
+	toStart := n - q.nWorkers
+	if toStart > 0 {
+		q.nWorkers += toStart
+	}
+	q.mu.Unlock()
+
+	for i := 0; i < toStart; i++ {
+		go q.worker()
+	}
+}
+
+// restore carrega jobs persistidos e reenfileira os que ficaram
+// queued/running quando o processo parou (crash recovery).
+func (q *jobQueue) restore() error {
+	var loaded []*Job
+	err := q.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(jobsBucket)
+		return b.ForEach(func(k, v []byte) error {
+			var job Job
+			if err := json.Unmarshal(v, &job); err != nil {
+				return err
+			}
+			loaded = append(loaded, &job)
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].CreatedAt.Before(loaded[j].CreatedAt) })
+
+	q.mu.Lock()
+	for _, job := range loaded {
+		q.jobs[job.ID] = job
+		q.order = append(q.order, job.ID)
+	}
+	q.mu.Unlock()
+
+	for _, job := range loaded {
+		if job.State == JobQueued || job.State == JobRunning {
+			job.State = JobQueued
+			q.persist(job)
+			q.pending <- job.ID
+		}
+	}
+	return nil
+}
+
+func (q *jobQueue) persist(job *Job) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return
+	}
+	_ = q.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(jobsBucket).Put([]byte(job.ID), data)
+	})
+}
+
+func (q *jobQueue) newJobID() string {
+	n := atomic.AddUint64(&q.idSeq, 1)
+	return time.Now().Format("20060102-150405") + "-" + strconv.FormatUint(n, 10)
+}
+
+// Enqueue registra um novo job e o entrega ao pool de workers.
+func (q *jobQueue) Enqueue(req actionReq) *Job {
+	job := &Job{
+		ID:        q.newJobID(),
+		Request:   req,
+		State:     JobQueued,
+		CreatedAt: time.Now(),
+	}
+	q.mu.Lock()
+	q.jobs[job.ID] = job
+	q.order = append(q.order, job.ID)
+	q.mu.Unlock()
+
+	q.persist(job)
+	q.pending <- job.ID
+	return job
+}
+
+// waitChan devolve um canal que é fechado quando o job atinge um estado
+// terminal; usado pelo handler /action legado para responder de forma
+// síncrona mesmo executando por trás da fila.
+func (q *jobQueue) waitChan(id string) <-chan struct{} {
+	ch := make(chan struct{})
+	q.mu.Lock()
+	job := q.jobs[id]
+	if job == nil || isTerminal(job.State) {
+		q.mu.Unlock()
+		close(ch)
+		return ch
+	}
+	q.waiters[id] = append(q.waiters[id], ch)
+	q.mu.Unlock()
+	return ch
+}
+
+func isTerminal(s JobState) bool {
+	return s == JobDone || s == JobError || s == JobCanceled
+}
+
+func (q *jobQueue) notifyDone(id string) {
+	q.mu.Lock()
+	chans := q.waiters[id]
+	delete(q.waiters, id)
+	q.mu.Unlock()
+	for _, ch := range chans {
+		close(ch)
+	}
+}
+
+func (q *jobQueue) Get(id string) (*Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	return job, ok
+}
+
+// List devolve os jobs na ordem de chegada, opcionalmente filtrados por
+// estado.
+func (q *jobQueue) List(state JobState) []*Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make([]*Job, 0, len(q.order))
+	for _, id := range q.order {
+		job := q.jobs[id]
+		if job == nil {
+			continue
+		}
+		if state != "" && job.State != state {
+			continue
+		}
+		out = append(out, job)
+	}
+	return out
+}
+
+// Cancel interrompe um job em execução ou marca um job em fila como
+// cancelado antes mesmo de começar.
+func (q *jobQueue) Cancel(id string) bool {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+	if !ok {
+		q.mu.Unlock()
+		return false
+	}
+	cancel := q.cancels[id]
+	wasQueued := false
+	switch job.State {
+	case JobQueued:
+		job.State = JobCanceled
+		job.FinishedAt = time.Now()
+		wasQueued = true
+	case JobRunning:
+		// o worker finaliza o job ao observar o context cancelado
+	default:
+		q.mu.Unlock()
+		return false
+	}
+	q.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	q.persist(job)
+	if wasQueued {
+		q.notifyDone(id)
+	}
+	return true
+}
+
+// Remove apaga definitivamente um job já finalizado (done/error/canceled).
+func (q *jobQueue) Remove(id string) bool {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+	if !ok || job.State == JobQueued || job.State == JobRunning {
+		q.mu.Unlock()
+		return false
+	}
+	delete(q.jobs, id)
+	for i, oid := range q.order {
+		if oid == id {
+			q.order = append(q.order[:i], q.order[i+1:]...)
+			break
+		}
+	}
+	q.mu.Unlock()
+
+	_ = q.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(jobsBucket).Delete([]byte(id))
+	})
+	return true
+}
+
+// Retry clona o pedido de um job existente em um novo job no fim da fila.
+func (q *jobQueue) Retry(id string) (*Job, bool) {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+	q.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return q.Enqueue(job.Request), true
+}
+
+func (q *jobQueue) worker() {
+	for id := range q.pending {
+		q.run(id)
+	}
+}
+
+func (q *jobQueue) run(id string) {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+	if !ok || job.State == JobCanceled {
+		q.mu.Unlock()
+		return
+	}
+	job.State = JobRunning
+	job.StartedAt = time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	q.cancels[id] = cancel
+	q.mu.Unlock()
+	q.persist(job)
+
+	ctx = withJobID(ctx, id)
+	ctx = withJobLog(ctx, &jobLogRecorder{})
+
+	out, err := runJobAction(ctx, job.Request)
+
+	q.mu.Lock()
+	delete(q.cancels, id)
+	if job.State != JobCanceled {
+		job.FinishedAt = time.Now()
+		job.LogTail = jobLogFromContext(ctx).Lines()
+		if err != nil {
+			if ctxCanceled(ctx) {
+				job.State = JobCanceled
+			} else {
+				job.State = JobError
+				job.Error = err.Error()
+			}
+		} else {
+			job.State = JobDone
+			job.OutputPath = out
+		}
+	}
+	jobCopy := *job
+	q.mu.Unlock()
+
+	q.persist(&jobCopy)
+	cancel()
+	q.notifyDone(id)
+}
+
+// runJobAction executa o pipeline correspondente à ação do pedido; é o
+// mesmo código que o handler /action legado usa, agora compartilhado pela
+// fila de jobs.
+func runJobAction(ctx context.Context, req actionReq) (string, error) {
+	if isHLSURL(req.URL) {
+		profile := req.Profile
+		if strings.ToLower(req.Action) == "download" {
+			profile = "original"
+		}
+		return handleHLS(ctx, req.URL, profile, req.Start, req.End, req.OutputDir, req.FormatID)
+	}
+
+	switch strings.ToLower(req.Action) {
+	case "download":
+		return handleDownload(ctx, req.URL, req.OutputDir, req.FormatID, req.AudioFormatID)
+	case "convert":
+		normalize, targetLUFS := req.Normalize, req.TargetLUFS
+		if globalConfig != nil {
+			cfg := globalConfig.Get()
+			// normalizeByDefault/targetLufs (config.yaml) só entram quando o
+			// pedido não pede normalização explicitamente nem informa um
+			// alvo próprio; um pedido explícito sempre tem prioridade.
+			if !normalize {
+				normalize = cfg.NormalizeByDefault
+			}
+			if targetLUFS == 0 {
+				targetLUFS = cfg.TargetLUFS
+			}
+		}
+		return handleConvert(ctx, req.URL, req.Profile, req.Start, req.End, req.OutputDir, req.FormatID, req.AudioFormatID, normalize, targetLUFS)
+	default:
+		return "", errUnknownAction
+	}
+}
+
+var errUnknownAction = jobActionError("ação desconhecida")
+
+type jobActionError string
+
+func (e jobActionError) Error() string { return string(e) }
+
+// ------------------- LOG POR JOB (ring buffer curto via context) -------------------
+
+type jobLogRecorder struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (r *jobLogRecorder) append(line string) {
+	if r == nil || strings.TrimSpace(line) == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines = append(r.lines, line)
+	if len(r.lines) > jobLogMaxLen {
+		r.lines = r.lines[len(r.lines)-jobLogMaxLen:]
+	}
+}
+
+func (r *jobLogRecorder) Lines() []string {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]string, len(r.lines))
+	copy(out, r.lines)
+	return out
+}
+
+const jobLogContextKey contextKey = jobIDContextKey + 1
+
+func withJobLog(ctx context.Context, recorder *jobLogRecorder) context.Context {
+	return context.WithValue(ctx, jobLogContextKey, recorder)
+}
+
+func jobLogFromContext(ctx context.Context) *jobLogRecorder {
+	recorder, _ := ctx.Value(jobLogContextKey).(*jobLogRecorder)
+	return recorder
+}
+
+func appendJobLog(ctx context.Context, line string) {
+	jobLogFromContext(ctx).append(line)
+}
+
+// ------------------- HTTP -------------------
+
+var globalJobQueue *jobQueue
+
+// globalConfig guarda as preferências do usuário carregadas de
+// ~/.videcutterapp/config.yaml (ver config/config.go); é nil apenas em testes que
+// não chamam main().
+var globalConfig *config.Manager
+
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs"), "/")
+
+	if path == "" {
+		switch r.Method {
+		case http.MethodPost:
+			jobsCreateHandler(w, r)
+		case http.MethodGet:
+			jobsListHandler(w, r)
+		default:
+			http.Error(w, "método não suportado", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	id := parts[0]
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		jobsDetailHandler(w, r, id)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		jobsDeleteHandler(w, r, id)
+	case len(parts) == 2 && parts[1] == "retry" && r.Method == http.MethodPost:
+		jobsRetryHandler(w, r, id)
+	default:
+		http.Error(w, "rota desconhecida", http.StatusNotFound)
+	}
+}
+
+func jobsCreateHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var req actionReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "payload inválido", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.URL) == "" {
+		http.Error(w, "URL do vídeo é obrigatória", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.OutputDir) == "" {
+		http.Error(w, "Selecione a pasta de destino.", http.StatusBadRequest)
+		return
+	}
+
+	job := globalJobQueue.Enqueue(req)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+func jobsListHandler(w http.ResponseWriter, r *http.Request) {
+	state := JobState(r.URL.Query().Get("state"))
+	jobs := globalJobQueue.List(state)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(jobs)
+}
+
+func jobsDetailHandler(w http.ResponseWriter, r *http.Request, id string) {
+	job, ok := globalJobQueue.Get(id)
+	if !ok {
+		http.Error(w, "job não encontrado", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(job)
+}
+
+func jobsDeleteHandler(w http.ResponseWriter, r *http.Request, id string) {
+	if _, ok := globalJobQueue.Get(id); !ok {
+		http.Error(w, "job não encontrado", http.StatusNotFound)
+		return
+	}
+	if globalJobQueue.Cancel(id) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "canceled": true})
+		return
+	}
+	if globalJobQueue.Remove(id) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "removed": true})
+		return
+	}
+	http.Error(w, "não foi possível cancelar/remover o job", http.StatusConflict)
+}
+
+func jobsRetryHandler(w http.ResponseWriter, r *http.Request, id string) {
+	job, ok := globalJobQueue.Retry(id)
+	if !ok {
+		http.Error(w, "job não encontrado", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ------------------- NORMALIZAÇÃO DE LOUDNESS (EBU R128 / ITU BS.1770) -------------------
+
+// defaultTargetLUFS é usado quando o pedido não informa um alvo explícito;
+// -16 LUFS é o valor recomendado para WhatsApp e voz em geral.
+const defaultTargetLUFS = -16.0
+
+// loudnormMeasured é o bloco JSON que o filtro loudnorm do ffmpeg imprime no
+// stderr ao final da passada de análise (print_format=json).
+type loudnormMeasured struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// analyzeLoudness roda a primeira passada do loudnorm (-f null -) e extrai o
+// bloco JSON de medição que o ffmpeg imprime no final do log.
+func analyzeLoudness(ctx context.Context, ff, inputFile string, targetLUFS, duration float64) (*loudnormMeasured, error) {
+	filter := fmt.Sprintf("loudnorm=I=%.1f:TP=-1.5:LRA=11:print_format=json", targetLUFS)
+	args := []string{
+		"-hide_banner", "-loglevel", "info", "-progress", "pipe:1", "-nostats",
+		"-i", inputFile, "-af", filter, "-f", "null", "-",
+	}
+	cmd := exec.CommandContext(ctx, ff, args...)
+
+	parser := newFfmpegProgressParser(duration)
+	combinedLog, stderrLog, err := runCmdWithProgress(cmd, func(line string) {
+		publishFfmpegLine(ctx, parser, "Normalizando (análise)", line)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("falha na análise de loudness (ffmpeg): %v\n%s", err, combinedLog)
+	}
+
+	// o bloco JSON do loudnorm sai inteiro em uma única escrita no stderr;
+	// usar stderrLog (em vez do log combinado com stdout) garante que nenhuma
+	// linha de progresso do stdout foi intercalada no meio dele.
+	start := strings.LastIndex(stderrLog, "{")
+	end := strings.LastIndex(stderrLog, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("não encontrei o bloco de medição do loudnorm na saída do ffmpeg")
+	}
+
+	var measured loudnormMeasured
+	if err := json.Unmarshal([]byte(stderrLog[start:end+1]), &measured); err != nil {
+		return nil, fmt.Errorf("falha ao interpretar medição do loudnorm: %v", err)
+	}
+	return &measured, nil
+}
+
+// loudnormFilter monta o filtro -af da passada final de encode, já calibrado
+// com os valores medidos na passada de análise.
+func loudnormFilter(targetLUFS float64, measured *loudnormMeasured) string {
+	return fmt.Sprintf(
+		"loudnorm=I=%.1f:TP=-1.5:LRA=11:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+		targetLUFS, measured.InputI, measured.InputTP, measured.InputLRA, measured.InputThresh, measured.TargetOffset,
+	)
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"embed"
-	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -21,7 +20,9 @@ import (
 	"strings"
 	"sync"
 	"time"
-	"unicode/utf16"
+
+	"videcutterapp/config"
+	"videcutterapp/folderpicker"
 )
 
 // ------------------- EMBED FRONTEND -------------------
@@ -49,61 +50,50 @@ func indexHandler(w http.ResponseWriter, r *http.Request) {
 
 // ------------------- STATUS (progresso simples) -------------------
 
-type appStatus struct {
-	mu      sync.Mutex
-	Running bool   `json:"running"`
-	Stage   string `json:"stage"` // "Aguardando", "Baixando", "Convertendo", "Finalizado", "Erro", "Cancelado"
-	Detail  string `json:"detail"`
-}
-
-var statusState = &appStatus{Stage: "Aguardando", Detail: ""}
-
-func setStage(stage, detail string, running bool) {
-	statusState.mu.Lock()
-	statusState.Stage = stage
-	statusState.Detail = detail
-	statusState.Running = running
-	statusState.mu.Unlock()
+// setStage publica um novo estágio no hub de progresso (ver /events em
+// progress.go); /status (statusHandler) expõe o último evento publicado.
+func setStage(ctx context.Context, stage, detail string, running bool) {
+	progressEvents.publish(ProgressEvent{JobID: jobIDFromContext(ctx), Stage: stage, Detail: detail, Running: running})
 }
 
-func getStatus() appStatus {
-	statusState.mu.Lock()
-	defer statusState.mu.Unlock()
-	return appStatus{
-		Running: statusState.Running,
-		Stage:   statusState.Stage,
-		Detail:  statusState.Detail,
-	}
-}
-
-// ------------------- CANCELAMENTO GLOBAL -------------------
+// ------------------- CANCELAMENTO -------------------
 
+// currentCancels mapeia job ID -> função de cancelamento, para que /cancel
+// consiga interromper o job certo mesmo com várias ações em andamento ao
+// mesmo tempo (várias abas, ou -concurrency > 1). Um único slot global aqui
+// seria sobrescrito pela segunda ação concorrente e cancelaria o job errado.
 var cancelMu sync.Mutex
-var currentCancel context.CancelFunc
+var currentCancels = make(map[string]context.CancelFunc)
 
-func setCurrentCancel(cf context.CancelFunc) {
+func setCurrentCancel(id string, cf context.CancelFunc) {
 	cancelMu.Lock()
-	currentCancel = cf
+	currentCancels[id] = cf
 	cancelMu.Unlock()
 }
-func clearCurrentCancel() {
+func clearCurrentCancel(id string) {
 	cancelMu.Lock()
-	currentCancel = nil
+	delete(currentCancels, id)
 	cancelMu.Unlock()
 }
 
 func cancelHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(r.URL.Query().Get("id"))
+	if id == "" {
+		http.Error(w, "parâmetro id é obrigatório (o id do job retornado por /action no cabeçalho X-Job-Id)", http.StatusBadRequest)
+		return
+	}
+
 	cancelMu.Lock()
-	cf := currentCancel
+	cf := currentCancels[id]
 	cancelMu.Unlock()
 
 	if cf == nil {
-		http.Error(w, "Nenhuma tarefa em execução.", http.StatusBadRequest)
+		http.Error(w, "Nenhuma tarefa em execução com esse id.", http.StatusBadRequest)
 		return
 	}
-	cf() // interrompe yt-dlp/ffmpeg
-	clearCurrentCancel()
-	setStage("Cancelado", "Ação cancelada pelo usuário.", false)
+	cf() // interrompe yt-dlp/ffmpeg desse job
+	clearCurrentCancel(id)
+	setStage(withJobID(r.Context(), id), "Cancelado", "Ação cancelada pelo usuário.", false)
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]any{"ok": true})
@@ -112,12 +102,16 @@ func cancelHandler(w http.ResponseWriter, r *http.Request) {
 // ------------------- REQ / UTIL -------------------
 
 type actionReq struct {
-	Action    string `json:"action"` // "download" | "convert"
-	URL       string `json:"url"`
-	Profile   string `json:"profile"`   // "original" | "whatsapp" | "480p" | "720p" | "1080p" | "4k" | "mp3"
-	Start     string `json:"start"`     // "HH:MM:SS" (opcional)
-	End       string `json:"end"`       // "HH:MM:SS" (opcional)
-	OutputDir string `json:"outputDir"` // diretório escolhido (OBRIGATÓRIO)
+	Action        string  `json:"action"` // "download" | "convert"
+	URL           string  `json:"url"`
+	Profile       string  `json:"profile"`       // "original" | "whatsapp" | "480p" | "720p" | "1080p" | "4k" | "mp3"
+	Start         string  `json:"start"`         // "HH:MM:SS" (opcional)
+	End           string  `json:"end"`           // "HH:MM:SS" (opcional)
+	OutputDir     string  `json:"outputDir"`     // diretório escolhido (OBRIGATÓRIO)
+	FormatID      string  `json:"formatId"`      // opcional: id de formato do yt-dlp (vídeo, ou combinado)
+	AudioFormatID string  `json:"audioFormatId"` // opcional: id de formato de áudio, combinado com FormatID
+	Normalize     bool    `json:"normalize"`     // opcional: aplica loudnorm (EBU R128) em duas passadas antes do encode final
+	TargetLUFS    float64 `json:"targetLufs"`    // opcional: alvo de loudness integrado (ex.: -16 WhatsApp, -14 YouTube, -19 podcast); 0 usa o padrão
 }
 
 func exeDir() string {
@@ -130,8 +124,16 @@ func cwdDir() string {
 	return d
 }
 
-// procura executáveis em exeDir, CWD e PATH
+// procura executáveis primeiro no config.yaml do usuário, depois em exeDir,
+// CWD e PATH
 func findTool(name string) (string, error) {
+	if globalConfig != nil {
+		if p := globalConfig.Get().ToolPath(name); p != "" {
+			if _, err := os.Stat(p); err == nil {
+				return p, nil
+			}
+		}
+	}
 	p1 := filepath.Join(exeDir(), name)
 	if _, err := os.Stat(p1); err == nil {
 		return p1, nil
@@ -293,7 +295,9 @@ func getVideoTitle(ctx context.Context, url string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	cmd := exec.CommandContext(ctx, yt, "--get-title", "--no-playlist", url)
+	args := append([]string{"--get-title", "--no-playlist"}, ytdlpNetworkArgs()...)
+	args = append(args, url)
+	cmd := exec.CommandContext(ctx, yt, args...)
 	out, err := runCmdWithLog(cmd)
 	if err != nil {
 		return "", fmt.Errorf("falha ao obter título: %v\n%s", err, out)
@@ -325,6 +329,11 @@ func resolveOutputDir(custom string) (string, error) {
 // ------------------- PRESETS / FFMPEG -------------------
 
 func ffmpegArgsPreset(profile string) []string {
+	if globalConfig != nil {
+		if args, ok := globalConfig.Get().Presets[strings.ToLower(profile)]; ok {
+			return args
+		}
+	}
 	switch strings.ToLower(profile) {
 	case "original":
 		return []string{"-c", "copy"}
@@ -389,25 +398,42 @@ func ffmpegArgsPreset(profile string) []string {
 	}
 }
 
+// ytdlpNetworkArgs monta as flags de rede do yt-dlp (cookies/proxy) a partir
+// do config.yaml do usuário; devolve nil quando não há nada configurado.
+func ytdlpNetworkArgs() []string {
+	if globalConfig == nil {
+		return nil
+	}
+	cfg := globalConfig.Get()
+	var args []string
+	if cfg.CookiesFile != "" {
+		args = append(args, "--cookies", cfg.CookiesFile)
+	}
+	if cfg.ProxyURL != "" {
+		args = append(args, "--proxy", cfg.ProxyURL)
+	}
+	return args
+}
+
 // ------------------- PIPELINES -------------------
 
 // BAIXAR (sem recodificar) com nome baseado no título
-func handleDownload(ctx context.Context, url, outDir string) (string, error) {
-	setStage("Baixando", "Sem recodificação (apenas mesclando streams)", true)
+func handleDownload(ctx context.Context, url, outDir, formatID, audioFormatID string) (string, error) {
+	setStage(ctx, "Baixando", "Sem recodificação (apenas mesclando streams)", true)
 
 	_, _, err := ensureDirs()
 	if err != nil {
-		setStage("Erro", err.Error(), false)
+		setStage(ctx, "Erro", err.Error(), false)
 		return "", err
 	}
 	yt, err := findTool("yt-dlp.exe")
 	if err != nil {
-		setStage("Erro", err.Error(), false)
+		setStage(ctx, "Erro", err.Error(), false)
 		return "", err
 	}
 	targetDir, err := resolveOutputDir(outDir)
 	if err != nil {
-		setStage("Erro", err.Error(), false)
+		setStage(ctx, "Erro", err.Error(), false)
 		return "", err
 	}
 
@@ -419,19 +445,24 @@ func handleDownload(ctx context.Context, url, outDir string) (string, error) {
 	outPrefix := filepath.Join(targetDir, title)
 	args := []string{
 		"-o", outPrefix + ".%(ext)s",
-		"-f", "bv*[ext=mp4]+ba[ext=m4a]/b[ext=mp4]/bv*+ba/b",
+		"-f", buildFormatSelector("original", formatID, audioFormatID),
 		"--merge-output-format", "mp4",
-		url,
+		"--newline",
+		"--progress-template", ytdlpProgressTemplate,
 	}
+	args = append(args, ytdlpNetworkArgs()...)
+	args = append(args, url)
 	cmd := exec.CommandContext(ctx, yt, args...)
-	log, runErr := runCmdWithLog(cmd)
+	log, _, runErr := runCmdWithProgress(cmd, func(line string) {
+		publishYtdlpLine(ctx, "Baixando", line)
+	})
 	if runErr != nil {
 		if ctxCanceled(ctx) {
 			// limpa artefatos parciais do download
 			cleanupDownloadArtifacts(outPrefix)
 			return "", context.Canceled
 		}
-		setStage("Erro", fmt.Sprintf("yt-dlp falhou:\n%s", log), false)
+		setStage(ctx, "Erro", fmt.Sprintf("yt-dlp falhou:\n%s", log), false)
 		return "", fmt.Errorf("falha ao baixar (yt-dlp): %v\n%s", runErr, log)
 	}
 
@@ -439,44 +470,47 @@ func handleDownload(ctx context.Context, url, outDir string) (string, error) {
 	if _, err := os.Stat(outFile); err != nil {
 		alt, err2 := findFirstGlob(outPrefix + ".*")
 		if err2 != nil {
-			setStage("Erro", "Não encontrei o arquivo de saída.", false)
+			setStage(ctx, "Erro", "Não encontrei o arquivo de saída.", false)
 			return "", fmt.Errorf("arquivo de saída não encontrado")
 		}
 		outFile = alt
 	}
 	openInExplorerSelect(outFile)
-	setStage("Finalizado", "Download concluído", false)
+	setStage(ctx, "Finalizado", "Download concluído", false)
 	return outFile, nil
 }
 
 // CONVERTER (recodifica; corte opcional) – inclui MP3 – com nome pelo título
-func handleConvert(ctx context.Context, url, profile, start, end, outDir string) (string, error) {
+func handleConvert(ctx context.Context, url, profile, start, end, outDir, formatID, audioFormatID string, normalize bool, targetLUFS float64) (string, error) {
 	if strings.ToLower(profile) == "original" {
-		return handleDownload(ctx, url, outDir)
+		return handleDownload(ctx, url, outDir, formatID, audioFormatID)
+	}
+	if targetLUFS == 0 {
+		targetLUFS = defaultTargetLUFS
 	}
 	if err := validateTimes(start, end); err != nil {
-		setStage("Erro", err.Error(), false)
+		setStage(ctx, "Erro", err.Error(), false)
 		return "", err
 	}
 	tempDir, _, err := ensureDirs()
 	if err != nil {
-		setStage("Erro", err.Error(), false)
+		setStage(ctx, "Erro", err.Error(), false)
 		return "", err
 	}
 	yt, err := findTool("yt-dlp.exe")
 	if err != nil {
-		setStage("Erro", err.Error(), false)
+		setStage(ctx, "Erro", err.Error(), false)
 		return "", err
 	}
 	ff, err := findTool("ffmpeg.exe")
 	if err != nil {
-		setStage("Erro", err.Error(), false)
+		setStage(ctx, "Erro", err.Error(), false)
 		return "", err
 	}
 
 	targetDir, err := resolveOutputDir(outDir)
 	if err != nil {
-		setStage("Erro", err.Error(), false)
+		setStage(ctx, "Erro", err.Error(), false)
 		return "", err
 	}
 	title, err := getVideoTitle(ctx, url)
@@ -487,20 +521,28 @@ func handleConvert(ctx context.Context, url, profile, start, end, outDir string)
 	outFile := filepath.Join(targetDir, title+ext)
 
 	// 1) Baixa temporário
-	setStage("Baixando", "Baixando vídeo original...", true)
+	setStage(ctx, "Baixando", "Baixando vídeo original...", true)
 
 	_ = os.RemoveAll(tempDir)
 	_ = os.MkdirAll(tempDir, 0755)
 	tempPattern := filepath.Join(tempDir, "video-temp.*")
 
-	ytArgs := []string{"-o", filepath.Join(tempDir, "video-temp.%(ext)s"), url}
+	ytArgs := []string{"-o", filepath.Join(tempDir, "video-temp.%(ext)s")}
+	if strings.TrimSpace(formatID) != "" {
+		ytArgs = append(ytArgs, "-f", buildFormatSelector(profile, formatID, audioFormatID))
+	}
+	ytArgs = append(ytArgs, "--newline", "--progress-template", ytdlpProgressTemplate)
+	ytArgs = append(ytArgs, ytdlpNetworkArgs()...)
+	ytArgs = append(ytArgs, url)
 	ytCmd := exec.CommandContext(ctx, yt, ytArgs...)
-	if log, runErr := runCmdWithLog(ytCmd); runErr != nil {
+	if log, _, runErr := runCmdWithProgress(ytCmd, func(line string) {
+		publishYtdlpLine(ctx, "Baixando", line)
+	}); runErr != nil {
 		if ctxCanceled(ctx) {
 			cleanupConvertTemp(tempDir, tempPattern, outFile)
 			return "", context.Canceled
 		}
-		setStage("Erro", fmt.Sprintf("yt-dlp falhou:\n%s", log), false)
+		setStage(ctx, "Erro", fmt.Sprintf("yt-dlp falhou:\n%s", log), false)
 		return "", fmt.Errorf("falha ao baixar (yt-dlp): %v\n%s", runErr, log)
 	}
 
@@ -510,55 +552,85 @@ func handleConvert(ctx context.Context, url, profile, start, end, outDir string)
 			cleanupConvertTemp(tempDir, tempPattern, outFile)
 			return "", context.Canceled
 		}
-		setStage("Erro", err.Error(), false)
+		setStage(ctx, "Erro", err.Error(), false)
 		return "", err
 	}
 
 	// 2) Converter
-	setStage("Convertendo", "Processando com ffmpeg...", true)
+	setStage(ctx, "Convertendo", "Processando com ffmpeg...", true)
+
+	duration, durErr := probeDuration(ctx, inputFile)
+	if durErr != nil {
+		duration = 0 // segue sem duração conhecida; percent fica em 0
+	}
+
+	var loudnormArgs []string
+	if normalize {
+		setStage(ctx, "Normalizando", "Analisando volume (1ª passada do loudnorm)...", true)
+		measured, err := analyzeLoudness(ctx, ff, inputFile, targetLUFS, duration)
+		if err != nil {
+			if ctxCanceled(ctx) {
+				cleanupConvertTemp(tempDir, tempPattern, outFile)
+				return "", context.Canceled
+			}
+			setStage(ctx, "Erro", err.Error(), false)
+			cleanupConvertTemp(tempDir, tempPattern, outFile)
+			return "", err
+		}
+		loudnormArgs = []string{"-af", loudnormFilter(targetLUFS, measured)}
+		setStage(ctx, "Convertendo", "Processando com ffmpeg...", true)
+	}
 
 	var ffArgs []string
-	ffArgs = append(ffArgs, "-hide_banner", "-loglevel", "info")
+	ffArgs = append(ffArgs, "-hide_banner", "-loglevel", "info", "-progress", "pipe:1", "-nostats")
 	if start != "" && end != "" {
 		ffArgs = append(ffArgs, "-ss", start, "-to", end)
 	}
 	ffArgs = append(ffArgs, "-i", inputFile)
 	ffArgs = append(ffArgs, ffmpegArgsPreset(profile)...)
+	ffArgs = append(ffArgs, loudnormArgs...)
 	if strings.ToLower(profile) != "mp3" {
 		ffArgs = append(ffArgs, "-avoid_negative_ts", "make_zero")
 	}
 	ffArgs = append(ffArgs, "-y", outFile)
 
 	ffCmd := exec.CommandContext(ctx, ff, ffArgs...)
-	if log, runErr := runCmdWithLog(ffCmd); runErr != nil {
+	ffParser := newFfmpegProgressParser(duration)
+	if log, _, runErr := runCmdWithProgress(ffCmd, func(line string) {
+		publishFfmpegLine(ctx, ffParser, "Convertendo", line)
+	}); runErr != nil {
 		if ctxCanceled(ctx) {
 			cleanupConvertTemp(tempDir, tempPattern, outFile)
 			return "", context.Canceled
 		}
 		// fallback: sem corte
 		if start != "" && end != "" {
-			ffArgs2 := []string{"-hide_banner", "-loglevel", "info", "-i", inputFile}
+			ffArgs2 := []string{"-hide_banner", "-loglevel", "info", "-progress", "pipe:1", "-nostats", "-i", inputFile}
 			ffArgs2 = append(ffArgs2, ffmpegArgsPreset(profile)...)
+			ffArgs2 = append(ffArgs2, loudnormArgs...)
 			if strings.ToLower(profile) != "mp3" {
 				ffArgs2 = append(ffArgs2, "-avoid_negative_ts", "make_zero")
 			}
 			ffArgs2 = append(ffArgs2, "-y", outFile)
 			ffCmd2 := exec.CommandContext(ctx, ff, ffArgs2...)
-			if log2, runErr2 := runCmdWithLog(ffCmd2); runErr2 == nil {
+			ffParser2 := newFfmpegProgressParser(duration)
+			if log2, _, runErr2 := runCmdWithProgress(ffCmd2, func(line string) {
+				publishFfmpegLine(ctx, ffParser2, "Convertendo", line)
+			}); runErr2 == nil {
 				_ = os.Remove(inputFile)
 				_ = os.RemoveAll(tempDir)
 				openInExplorerSelect(outFile)
-				setStage("Finalizado", "Conversão concluída (fallback sem corte).", false)
+				setStage(ctx, "Finalizado", "Conversão concluída (fallback sem corte).", false)
 				return outFile, nil
 			} else {
 				errMsg := fmt.Sprintf("ffmpeg falhou.\n---LOG 1 (com corte)---\n%s\n---LOG 2 (sem corte)---\n%s", log, log2)
-				setStage("Erro", errMsg, false)
+				setStage(ctx, "Erro", errMsg, false)
 				cleanupConvertTemp(tempDir, tempPattern, outFile)
 				return "", fmt.Errorf(errMsg)
 			}
 		}
 		errMsg := fmt.Sprintf("ffmpeg falhou:\n%s", log)
-		setStage("Erro", errMsg, false)
+		setStage(ctx, "Erro", errMsg, false)
 		cleanupConvertTemp(tempDir, tempPattern, outFile)
 		return "", fmt.Errorf(errMsg)
 	}
@@ -568,48 +640,92 @@ func handleConvert(ctx context.Context, url, profile, start, end, outDir string)
 	_ = os.RemoveAll(tempDir)
 
 	openInExplorerSelect(outFile)
-	setStage("Finalizado", "Conversão concluída com sucesso.", false)
+	setStage(ctx, "Finalizado", "Conversão concluída com sucesso.", false)
 	return outFile, nil
 }
 
-// ------------------- WINDOWS: SELETOR DE PASTA -------------------
+// ------------------- SELETOR DE PASTA NATIVO -------------------
 
 type pickFolderResp struct {
-	Path string `json:"path"`
+	Path     string `json:"path"`
+	Canceled bool   `json:"canceled,omitempty"`
+}
+
+type pickFolderCapabilitiesResp struct {
+	Supported bool   `json:"supported"`
+	Backend   string `json:"backend,omitempty"`
 }
 
 func pickFolderHandler(w http.ResponseWriter, r *http.Request) {
-	if runtime.GOOS != "windows" {
-		http.Error(w, "Seleção de pasta suportada apenas no Windows.", http.StatusNotImplemented)
-		return
-	}
-	ps := `Add-Type -AssemblyName System.Windows.Forms; $fbd = New-Object System.Windows.Forms.FolderBrowserDialog; if($fbd.ShowDialog() -eq 'OK'){[Console]::Out.Write($fbd.SelectedPath)}`
-	cmd := exec.Command("powershell", "-NoProfile", "-STA", "-Command", ps)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &out
-	err := cmd.Run()
+	path, canceled, err := folderpicker.Pick()
 	if err != nil {
-		http.Error(w, "Falha ao abrir seletor de pasta: "+out.String(), http.StatusInternalServerError)
+		http.Error(w, "Falha ao abrir seletor de pasta: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(pickFolderResp{Path: path, Canceled: canceled})
+}
 
-	raw := out.Bytes()
-	if len(raw) >= 2 && raw[0] == 0xFF && raw[1] == 0xFE {
-		raw = raw[2:]
-	}
-	u16 := make([]uint16, 0, len(raw)/2)
-	for i := 0; i+1 < len(raw); i += 2 {
-		u16 = append(u16, binary.LittleEndian.Uint16(raw[i:]))
+func pickFolderCapabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	supported, backend := folderpicker.Capabilities()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(pickFolderCapabilitiesResp{Supported: supported, Backend: backend})
+}
+
+// ------------------- CONFIGURAÇÃO DO USUÁRIO -------------------
+
+// configHandler expõe o config.yaml do usuário para o frontend: GET devolve
+// a configuração corrente e PUT substitui e persiste uma nova, aplicando-a
+// com applyConfigChange, a mesma função chamada quando o arquivo é editado
+// manualmente.
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(globalConfig.Get())
+	case http.MethodPut:
+		defer r.Body.Close()
+		var next config.Config
+		if err := json.NewDecoder(r.Body).Decode(&next); err != nil {
+			http.Error(w, "payload inválido", http.StatusBadRequest)
+			return
+		}
+		old := globalConfig.Get()
+		if err := globalConfig.Save(next); err != nil {
+			http.Error(w, "falha ao salvar configuração: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		applyConfigChange(old, next)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(next)
+	default:
+		http.Error(w, "método não suportado", http.StatusMethodNotAllowed)
 	}
-	path := strings.TrimSpace(string(utf16.Decode(u16)))
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(pickFolderResp{Path: path})
+// applyConfigChange loga o que mudou entre duas configurações e, quando a
+// concorrência foi alterada, repassa o novo valor a SetConcurrency: um
+// aumento abre novos workers; uma redução não encerra nenhum worker já
+// aberto.
+func applyConfigChange(old, next config.Config) {
+	diffs := config.Diff(old, next)
+	if len(diffs) == 0 {
+		return
+	}
+	log.Println("config: recarregado com mudanças:")
+	for _, d := range diffs {
+		log.Println("  -", d)
+	}
+	if old.Concurrency != next.Concurrency {
+		globalJobQueue.SetConcurrency(next.Concurrency)
+	}
 }
 
 // ------------------- HTTP -------------------
 
+// actionHandler é mantido por compatibilidade com o frontend atual: ele
+// enfileira o pedido na fila de jobs e aguarda a conclusão antes de
+// responder, em vez de executar o pipeline diretamente.
 func actionHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "método não suportado", http.StatusMethodNotAllowed)
@@ -630,53 +746,47 @@ func actionHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Selecione a pasta de destino.", http.StatusBadRequest)
 		return
 	}
-
-	if getStatus().Running {
-		http.Error(w, "Já existe uma tarefa em execução. Aguarde terminar.", http.StatusConflict)
+	action := strings.ToLower(req.Action)
+	if action != "download" && action != "convert" {
+		http.Error(w, "ação desconhecida", http.StatusBadRequest)
 		return
 	}
 
-	setStage("Aguardando", "Iniciando tarefa...", true)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
-	setCurrentCancel(cancel)
-	defer func() {
-		cancel()
-		clearCurrentCancel()
-	}()
+	job := globalJobQueue.Enqueue(req)
+	w.Header().Set("X-Job-Id", job.ID) // permite que o chamador cancele via /cancel?id=
+	setCurrentCancel(job.ID, func() { globalJobQueue.Cancel(job.ID) })
+	defer clearCurrentCancel(job.ID)
 
-	switch strings.ToLower(req.Action) {
-	case "download":
-		out, err := handleDownload(ctx, req.URL, req.OutputDir)
-		if err != nil {
-			if errors.Is(err, context.Canceled) {
-				http.Error(w, "Operação cancelada pelo usuário.", http.StatusRequestTimeout)
-				return
-			}
-			http.Error(w, "Erro ao baixar: "+err.Error(), http.StatusInternalServerError)
-			return
+	select {
+	case <-globalJobQueue.waitChan(job.ID):
+	case <-r.Context().Done():
+		return
+	}
+
+	job, _ = globalJobQueue.Get(job.ID)
+	switch job.State {
+	case JobCanceled:
+		http.Error(w, "Operação cancelada pelo usuário.", http.StatusRequestTimeout)
+	case JobError:
+		prefix := "Erro na conversão: "
+		if action == "download" {
+			prefix = "Erro ao baixar: "
 		}
-		openInExplorerSelect(out)
-		_, _ = w.Write([]byte("✅ Download concluído: " + filepath.Base(out)))
-	case "convert":
-		out, err := handleConvert(ctx, req.URL, req.Profile, req.Start, req.End, req.OutputDir)
-		if err != nil {
-			if errors.Is(err, context.Canceled) {
-				http.Error(w, "Operação cancelada pelo usuário.", http.StatusRequestTimeout)
-				return
-			}
-			http.Error(w, "Erro na conversão: "+err.Error(), http.StatusInternalServerError)
-			return
+		http.Error(w, prefix+job.Error, http.StatusInternalServerError)
+	case JobDone:
+		if action == "download" {
+			_, _ = w.Write([]byte("✅ Download concluído: " + filepath.Base(job.OutputPath)))
+		} else {
+			_, _ = w.Write([]byte("✅ Conversão concluída: " + filepath.Base(job.OutputPath)))
 		}
-		_, _ = w.Write([]byte("✅ Conversão concluída: " + filepath.Base(out)))
-	default:
-		http.Error(w, "ação desconhecida", http.StatusBadRequest)
 	}
 }
 
+// statusHandler agora é um fallback leve para clientes que não usam SSE:
+// devolve o último ProgressEvent publicado no hub de /events.
 func statusHandler(w http.ResponseWriter, r *http.Request) {
-	st := getStatus()
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(st)
+	_ = json.NewEncoder(w).Encode(progressEvents.Last())
 }
 
 // ------------------- MAIN -------------------
@@ -687,18 +797,56 @@ func main() {
 		return
 	}
 
-	addr := flag.String("addr", "127.0.0.1:8080", "endereço do servidor")
+	addr := flag.String("addr", "", "endereço do servidor (sobrescreve o config.yaml)")
+	concurrency := flag.Int("concurrency", 0, "número de jobs processados em paralelo (sobrescreve o config.yaml)")
+	configPath := flag.String("config", "", "caminho do config.yaml (padrão: ~/.videcutterapp/config.yaml)")
 	flag.Parse()
 
+	cfgMgr, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Println("Erro ao carregar configuração:", err)
+		return
+	}
+	globalConfig = cfgMgr
+	defer globalConfig.Close()
+	cfg := cfgMgr.Get()
+
+	listenAddr := cfg.ListenAddr
+	if *addr != "" {
+		listenAddr = *addr
+	}
+	concurrencyVal := cfg.Concurrency
+	if *concurrency != 0 {
+		concurrencyVal = *concurrency
+	}
+
+	base := exeDir()
+	queue, err := newJobQueue(filepath.Join(base, "jobs.db"), concurrencyVal)
+	if err != nil {
+		fmt.Println("Erro ao iniciar a fila de jobs:", err)
+		return
+	}
+	globalJobQueue = queue
+
+	if err := cfgMgr.Watch(applyConfigChange); err != nil {
+		log.Println("config: recarregamento automático desativado:", err)
+	}
+
 	http.HandleFunc("/", indexHandler)
 	http.HandleFunc("/action", actionHandler)
+	http.HandleFunc("/formats", formatsHandler)
 	http.HandleFunc("/status", statusHandler)
+	http.HandleFunc("/events", eventsHandler)
 	http.HandleFunc("/pick-folder", pickFolderHandler)
+	http.HandleFunc("/pick-folder/capabilities", pickFolderCapabilitiesHandler)
 	http.HandleFunc("/cancel", cancelHandler)
+	http.HandleFunc("/jobs", jobsHandler)
+	http.HandleFunc("/jobs/", jobsHandler)
+	http.HandleFunc("/config", configHandler)
 
-	go openBrowser("http://" + *addr)
-	fmt.Println("🚀 Servidor rodando em http://" + *addr)
-	if err := http.ListenAndServe(*addr, nil); err != nil {
+	go openBrowser("http://" + listenAddr)
+	fmt.Println("🚀 Servidor rodando em http://" + listenAddr)
+	if err := http.ListenAndServe(listenAddr, nil); err != nil {
 		fmt.Println("Erro no servidor:", err)
 	}
 }
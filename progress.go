@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ------------------- EVENTOS DE PROGRESSO (SSE) -------------------
+
+// ProgressEvent é o payload estruturado transmitido via /events, derivado
+// do parsing ao vivo da saída do yt-dlp (--progress-template) e do ffmpeg
+// (-progress pipe:1).
+type ProgressEvent struct {
+	JobID          string  `json:"jobId,omitempty"`
+	Stage          string  `json:"stage"`
+	Detail         string  `json:"detail,omitempty"`
+	Running        bool    `json:"running"`
+	Percent        float64 `json:"percent"`
+	Speed          string  `json:"speed,omitempty"`
+	ETA            string  `json:"eta,omitempty"`
+	Fragment       int     `json:"fragment,omitempty"`
+	TotalFragments int     `json:"totalFragments,omitempty"`
+	Timemark       string  `json:"timemark,omitempty"`
+	FPS            float64 `json:"fps,omitempty"`
+}
+
+// progressHub distribui eventos a todos os clientes SSE conectados; cada
+// assinante tem seu próprio canal com buffer e eventos são descartados
+// (não bloqueiam o pipeline) se o assinante estiver lento.
+type progressHub struct {
+	mu   sync.Mutex
+	subs map[chan ProgressEvent]struct{}
+	last ProgressEvent
+}
+
+func newProgressHub() *progressHub {
+	return &progressHub{
+		subs: make(map[chan ProgressEvent]struct{}),
+		last: ProgressEvent{Stage: "Aguardando"},
+	}
+}
+
+func (h *progressHub) subscribe() chan ProgressEvent {
+	ch := make(chan ProgressEvent, 8)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *progressHub) unsubscribe(ch chan ProgressEvent) {
+	h.mu.Lock()
+	delete(h.subs, ch)
+	h.mu.Unlock()
+	close(ch)
+}
+
+func (h *progressHub) publish(ev ProgressEvent) {
+	h.mu.Lock()
+	h.last = ev
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+			// assinante lento: descarta o evento em vez de travar o pipeline
+		}
+	}
+	h.mu.Unlock()
+}
+
+func (h *progressHub) Last() ProgressEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.last
+}
+
+var progressEvents = newProgressHub()
+
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming não suportado neste servidor", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ch := progressEvents.subscribe()
+	defer progressEvents.unsubscribe(ch)
+
+	writeSSEEvent(w, progressEvents.Last())
+	flusher.Flush()
+
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			writeSSEEvent(w, ev)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeSSEEvent(w http.ResponseWriter, ev ProgressEvent) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
+
+// ------------------- EXECUÇÃO COM PROGRESSO AO VIVO -------------------
+
+// runCmdWithProgress executa cmd lendo stdout/stderr linha a linha (em vez
+// de acumular tudo em um bytes.Buffer) para permitir parsing de progresso
+// em tempo real via onLine. stdout e stderr são acumulados em buffers
+// separados — cada um só é escrito pela sua própria goroutine de coleta,
+// então não corre risco de intercalar uma linha de progresso do stdout no
+// meio de um bloco (ex.: o JSON do loudnorm) que o processo imprimiu de uma
+// vez no stderr. combinedLog concatena os dois (stdout, depois stderr) só
+// para diagnóstico de erro; quem precisa de um stream isolado e íntegro
+// (como analyzeLoudness) deve usar stderrLog.
+func runCmdWithProgress(cmd *exec.Cmd, onLine func(line string)) (combinedLog, stderrLog string, err error) {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", "", err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return "", "", err
+	}
+
+	var stdoutLines, stderrLines []string
+	collect := func(r io.Reader, dst *[]string, wg *sync.WaitGroup) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		// yt-dlp/ffmpeg usam \r para atualizar a linha de progresso no local
+		scanner.Split(scanLinesOrCR)
+		for scanner.Scan() {
+			line := scanner.Text()
+			*dst = append(*dst, line)
+			onLine(line)
+		}
+	}
+
+	if err := cmd.Start(); err != nil {
+		return "", "", err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go collect(stdout, &stdoutLines, &wg)
+	go collect(stderr, &stderrLines, &wg)
+	wg.Wait()
+
+	runErr := cmd.Wait()
+	stderrLog = strings.TrimSpace(strings.Join(stderrLines, "\n"))
+	combinedLog = strings.TrimSpace(strings.Join(stdoutLines, "\n") + "\n" + stderrLog)
+	return combinedLog, stderrLog, runErr
+}
+
+// scanLinesOrCR quebra em '\n' ou '\r', já que ferramentas de CLI usam '\r'
+// para reescrever a linha de progresso no terminal.
+func scanLinesOrCR(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	for i, b := range data {
+		if b == '\n' || b == '\r' {
+			return i + 1, data[:i], nil
+		}
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// ------------------- PARSER: yt-dlp (--progress-template) -------------------
+
+const ytdlpProgressPrefix = "CUTTERAPP-PROGRESS|"
+const ytdlpProgressTemplate = ytdlpProgressPrefix +
+	"%(progress.downloaded_bytes)s|%(progress.total_bytes)s|%(progress.speed)s|%(progress.eta)s|%(progress.fragment_index)s|%(progress.fragment_count)s"
+
+func parseYtdlpProgressLine(line string) (ProgressEvent, bool) {
+	if !strings.HasPrefix(line, ytdlpProgressPrefix) {
+		return ProgressEvent{}, false
+	}
+	parts := strings.Split(strings.TrimPrefix(line, ytdlpProgressPrefix), "|")
+	if len(parts) != 6 {
+		return ProgressEvent{}, false
+	}
+	downloaded, _ := strconv.ParseFloat(parts[0], 64)
+	total, _ := strconv.ParseFloat(parts[1], 64)
+	speed, _ := strconv.ParseFloat(parts[2], 64)
+	eta, _ := strconv.ParseFloat(parts[3], 64)
+	fragIdx, _ := strconv.Atoi(parts[4])
+	fragCount, _ := strconv.Atoi(parts[5])
+
+	var percent float64
+	if total > 0 {
+		percent = downloaded / total * 100
+	}
+
+	return ProgressEvent{
+		Percent:        percent,
+		Speed:          humanizeBytesPerSec(speed),
+		ETA:            humanizeSeconds(eta),
+		Fragment:       fragIdx,
+		TotalFragments: fragCount,
+	}, true
+}
+
+// contextKey evita colisão com outras chaves de context.Value usadas por
+// pacotes de terceiros.
+type contextKey int
+
+const jobIDContextKey contextKey = iota
+
+// withJobID anexa o id do job corrente ao contexto, para que o hub de SSE
+// consiga multiplexar eventos de progresso por jobId.
+func withJobID(ctx context.Context, jobID string) context.Context {
+	return context.WithValue(ctx, jobIDContextKey, jobID)
+}
+
+func jobIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(jobIDContextKey).(string)
+	return id
+}
+
+// publishYtdlpLine faz o parsing de uma linha de saída do yt-dlp e, se ela
+// carregar progresso, publica no hub já com o estágio corrente.
+func publishYtdlpLine(ctx context.Context, stage, line string) {
+	if ev, ok := parseYtdlpProgressLine(line); ok {
+		ev.JobID = jobIDFromContext(ctx)
+		ev.Stage = stage
+		ev.Running = true
+		progressEvents.publish(ev)
+	}
+	appendJobLog(ctx, line)
+}
+
+// publishFfmpegLine é o equivalente para blocos de progresso do ffmpeg.
+func publishFfmpegLine(ctx context.Context, parser *ffmpegProgressParser, stage, line string) {
+	if ev, ok := parser.feed(line); ok {
+		ev.JobID = jobIDFromContext(ctx)
+		ev.Stage = stage
+		ev.Running = true
+		progressEvents.publish(ev)
+	}
+	appendJobLog(ctx, line)
+}
+
+// ------------------- PARSER: ffmpeg (-progress pipe:1) -------------------
+
+// ffmpegProgressParser acumula as linhas "chave=valor" de um bloco de
+// progresso do ffmpeg (finalizado por "progress=continue"/"progress=end")
+// e emite um ProgressEvent por bloco.
+type ffmpegProgressParser struct {
+	duration float64
+	kv       map[string]string
+}
+
+func newFfmpegProgressParser(duration float64) *ffmpegProgressParser {
+	return &ffmpegProgressParser{duration: duration, kv: map[string]string{}}
+}
+
+func (p *ffmpegProgressParser) feed(line string) (ProgressEvent, bool) {
+	idx := strings.Index(line, "=")
+	if idx < 0 {
+		return ProgressEvent{}, false
+	}
+	key := strings.TrimSpace(line[:idx])
+	val := strings.TrimSpace(line[idx+1:])
+	p.kv[key] = val
+	if key != "progress" {
+		return ProgressEvent{}, false
+	}
+	defer func() { p.kv = map[string]string{} }()
+
+	outTimeMs, _ := strconv.ParseFloat(p.kv["out_time_ms"], 64)
+	fps, _ := strconv.ParseFloat(p.kv["fps"], 64)
+	seconds := outTimeMs / 1_000_000
+
+	var percent float64
+	if p.duration > 0 {
+		percent = seconds / p.duration * 100
+		if percent > 100 {
+			percent = 100
+		}
+	}
+
+	return ProgressEvent{
+		Percent:  percent,
+		Speed:    p.kv["speed"],
+		Timemark: humanizeSeconds(seconds),
+		FPS:      fps,
+	}, true
+}
+
+// ------------------- DURAÇÃO DE ENTRADA (ffprobe, cacheada) -------------------
+
+var durationCache sync.Map // string (path) -> float64 (segundos)
+
+func probeDuration(ctx context.Context, path string) (float64, error) {
+	if v, ok := durationCache.Load(path); ok {
+		return v.(float64), nil
+	}
+	ffprobe, err := findTool("ffprobe.exe")
+	if err != nil {
+		return 0, err
+	}
+	cmd := exec.CommandContext(ctx, ffprobe, "-v", "error", "-show_entries", "format=duration", "-of", "json", path)
+	raw, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("falha ao executar ffprobe: %v", err)
+	}
+
+	var parsed struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return 0, fmt.Errorf("falha ao interpretar saída do ffprobe: %v", err)
+	}
+	d, err := strconv.ParseFloat(parsed.Format.Duration, 64)
+	if err != nil {
+		return 0, fmt.Errorf("duração inválida retornada pelo ffprobe: %v", err)
+	}
+	durationCache.Store(path, d)
+	return d, nil
+}
+
+// ------------------- HELPERS DE FORMATAÇÃO -------------------
+
+func humanizeBytesPerSec(bps float64) string {
+	if bps <= 0 {
+		return ""
+	}
+	const unit = 1024.0
+	units := []string{"B/s", "KiB/s", "MiB/s", "GiB/s"}
+	i := 0
+	for bps >= unit && i < len(units)-1 {
+		bps /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", bps, units[i])
+}
+
+func humanizeSeconds(seconds float64) string {
+	if seconds < 0 {
+		return ""
+	}
+	d := time.Duration(seconds * float64(time.Second))
+	total := int(d.Seconds())
+	h := total / 3600
+	m := (total % 3600) / 60
+	s := total % 60
+	if h > 0 {
+		return fmt.Sprintf("%02d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%02d:%02d", m, s)
+}